@@ -0,0 +1,245 @@
+package consullocator
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// blockingWait is the maximum time a blocking query waits for the service to change
+	blockingWait = 5 * time.Minute
+	// watchRetryDelay is the time waited before retrying a failed query
+	watchRetryDelay = 5 * time.Second
+)
+
+type consulLocator struct {
+	client     *http.Client
+	consulURL  *url.URL
+	service    string
+	tag        string
+	datacenter string
+	token      string
+	scheme     string
+	// watch-backed state
+	mutex   sync.RWMutex
+	synced  bool
+	targets []*locator.Target
+	changes chan struct{}
+}
+
+// serviceEntry is an entry of the response from consul's '/v1/health/service/:service' endpoint
+type serviceEntry struct {
+	Node struct {
+		Node       string
+		Address    string
+		Datacenter string
+	}
+	Service struct {
+		ID      string
+		Service string
+		Address string
+		Port    int
+		Tags    []string
+		Meta    map[string]string
+	}
+	Checks []struct {
+		CheckID string
+		Name    string
+		Status  string
+	}
+}
+
+func (cl *consulLocator) String() string {
+	return fmt.Sprintf("%T{url: %s, service: %s, tag: %s}", cl, cl.consulURL, cl.service, cl.tag)
+}
+
+// NewConsulLocator generates a new consul prometheus locator, which finds the instances of the named
+// service (optionally, only those with the provided tag) registered with the consul agent at consulURL
+func NewConsulLocator(consulURL, service, tag, datacenter, token, scheme string, insecure bool) (locator.Locator, error) {
+
+	if len(service) == 0 {
+		return nil, fmt.Errorf("A consul service name is required")
+	}
+	u, err := url.Parse(consulURL)
+	if err != nil || len(u.Host) == 0 {
+		return nil, fmt.Errorf("Invalid consul URL '%s'", consulURL)
+	}
+	if len(scheme) == 0 {
+		scheme = "http"
+	}
+
+	// consul adds up to wait/16 of jitter to blocking queries
+	client := &http.Client{Timeout: blockingWait + time.Minute}
+	if insecure {
+		client.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+
+	cl := &consulLocator{
+		client:     client,
+		consulURL:  u,
+		service:    service,
+		tag:        tag,
+		datacenter: datacenter,
+		token:      token,
+		scheme:     scheme,
+		changes:    make(chan struct{}, 1),
+	}
+	go cl.watch()
+	return cl, nil
+}
+
+// Endpoints provides a list of candidate prometheus endpoints
+func (cl *consulLocator) Endpoints() ([]*locator.PrometheusEndpoint, error) {
+	cl.mutex.RLock()
+	synced, targets := cl.synced, cl.targets
+	cl.mutex.RUnlock()
+
+	if !synced {
+		// the watch has not (yet) succeeded; fall back to polling
+		entries, _, err := cl.query(0)
+		if err != nil {
+			return nil, err
+		}
+		targets = cl.entryTargets(entries)
+	}
+	return locator.ProbeTargets(targets)
+}
+
+// Changes provides a channel which receives a value whenever the candidate endpoints change
+func (cl *consulLocator) Changes() <-chan struct{} {
+	return cl.changes
+}
+
+// watch maintains the cached targets using blocking queries, which return as soon as
+// the service's instances (or their health) change
+func (cl *consulLocator) watch() {
+	var index uint64
+	for {
+		entries, newIndex, err := cl.query(index)
+		if err != nil {
+			log.Warnf("Query for %v failed; retrying in %s: %v", cl, watchRetryDelay, err)
+			time.Sleep(watchRetryDelay)
+			continue
+		}
+		if newIndex < index {
+			// the index went backwards (e.g., the raft state was restored); start over
+			newIndex = 0
+		}
+		index = newIndex
+		cl.update(cl.entryTargets(entries))
+		if index == 0 {
+			// the next query won't block; avoid querying in a tight loop
+			time.Sleep(watchRetryDelay)
+		}
+	}
+}
+
+// query fetches the instances of the service; when index is non-zero, the query blocks
+// until the service changes after that index, or until the wait time elapses
+func (cl *consulLocator) query(index uint64) ([]*serviceEntry, uint64, error) {
+	u := *cl.consulURL
+	u.Path = strings.TrimRight(u.Path, "/") + "/v1/health/service/" + url.PathEscape(cl.service)
+	params := url.Values{}
+	if len(cl.tag) > 0 {
+		params.Set("tag", cl.tag)
+	}
+	if len(cl.datacenter) > 0 {
+		params.Set("dc", cl.datacenter)
+	}
+	if index > 0 {
+		params.Set("index", strconv.FormatUint(index, 10))
+		params.Set("wait", fmt.Sprintf("%ds", int(blockingWait.Seconds())))
+	}
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(cl.token) > 0 {
+		req.Header.Set("X-Consul-Token", cl.token)
+	}
+	resp, err := cl.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("GET %s returned %s", u.Path, resp.Status)
+	}
+
+	var entries []*serviceEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, 0, fmt.Errorf("Failed to decode response from %s: %v", u.Path, err)
+	}
+	newIndex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	return entries, newIndex, nil
+}
+
+// entryTargets builds the list of targets from the service instances; the service metadata becomes
+// the target's labels, and instances with health checks that are not passing are included as not-ready targets
+func (cl *consulLocator) entryTargets(entries []*serviceEntry) []*locator.Target {
+	targets := []*locator.Target{}
+	for _, entry := range entries {
+		address := entry.Service.Address
+		if len(address) == 0 {
+			address = entry.Node.Address
+		}
+		labels := make(map[string]string, len(entry.Service.Meta))
+		for name, value := range entry.Service.Meta {
+			labels[name] = value
+		}
+		targets = append(targets, &locator.Target{
+			Address:        fmt.Sprintf("%s://%s", cl.scheme, net.JoinHostPort(address, strconv.Itoa(entry.Service.Port))),
+			Labels:         labels,
+			NotReadyReason: notReadyReason(entry),
+		})
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Address < targets[j].Address })
+	return targets
+}
+
+// notReadyReason returns a description of the first health check of the instance which
+// is not passing, or the empty string if all checks are passing
+func notReadyReason(entry *serviceEntry) string {
+	for _, check := range entry.Checks {
+		if check.Status != "passing" {
+			return fmt.Sprintf("consul check '%s' is %s", check.Name, check.Status)
+		}
+	}
+	return ""
+}
+
+// update replaces the cached targets, signaling a change if they differ from the previous targets
+func (cl *consulLocator) update(targets []*locator.Target) {
+	cl.mutex.Lock()
+	changed := !cl.synced || !reflect.DeepEqual(targets, cl.targets)
+	cl.synced = true
+	cl.targets = targets
+	cl.mutex.Unlock()
+
+	if changed {
+		if log.GetLevel() >= log.DebugLevel {
+			log.Debugf("Targets for %v changed: %v", cl, targets)
+		}
+		select {
+		case cl.changes <- struct{}{}:
+		default:
+		}
+	}
+}
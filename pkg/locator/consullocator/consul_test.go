@@ -0,0 +1,132 @@
+package consullocator
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeConsul serves the health endpoint of a single service, honoring blocking queries
+type fakeConsul struct {
+	mutex    sync.Mutex
+	index    uint64
+	entries  string
+	changed  chan struct{}
+	requests []*http.Request
+}
+
+func newFakeConsul(entries string) *fakeConsul {
+	return &fakeConsul{index: 1, entries: entries, changed: make(chan struct{})}
+}
+
+func (c *fakeConsul) set(entries string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.index++
+	c.entries = entries
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *fakeConsul) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/v1/health/service/prometheus" {
+		http.NotFound(w, req)
+		return
+	}
+	c.mutex.Lock()
+	c.requests = append(c.requests, req)
+	index, changed := c.index, c.changed
+	c.mutex.Unlock()
+
+	if waitIndex, _ := strconv.ParseUint(req.URL.Query().Get("index"), 10, 64); waitIndex >= index {
+		select {
+		case <-changed:
+		case <-time.After(2 * time.Second):
+		case <-req.Context().Done():
+			return
+		}
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(c.index, 10))
+	fmt.Fprint(w, c.entries)
+}
+
+const healthyEntries = `[
+	{"Node": {"Node": "node-1", "Address": "10.0.0.1"},
+		"Service": {"ID": "prometheus-1", "Service": "prometheus", "Port": 9090, "Tags": ["primary"],
+			"Meta": {"replica": "a"}},
+		"Checks": [{"CheckID": "serfHealth", "Name": "Serf Health Status", "Status": "passing"}]},
+	{"Node": {"Node": "node-2", "Address": "10.0.0.2"},
+		"Service": {"ID": "prometheus-2", "Service": "prometheus", "Address": "10.0.1.2", "Port": 9091,
+			"Meta": {"replica": "b"}},
+		"Checks": [{"CheckID": "serfHealth", "Name": "Serf Health Status", "Status": "passing"}]}
+]`
+
+const unhealthyEntries = `[
+	{"Node": {"Node": "node-1", "Address": "10.0.0.1"},
+		"Service": {"ID": "prometheus-1", "Service": "prometheus", "Port": 9090, "Meta": {"replica": "a"}},
+		"Checks": [{"CheckID": "prometheus-1-ready", "Name": "ready", "Status": "critical"}]}
+]`
+
+func awaitChange(changes <-chan struct{}) bool {
+	select {
+	case <-changes:
+		return true
+	case <-time.After(5 * time.Second):
+		return false
+	}
+}
+
+func TestWatchService(t *testing.T) {
+	fake := newFakeConsul(healthyEntries)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	l, err := NewConsulLocator(server.URL, "prometheus", "primary", "dc1", "secret", "", false)
+	assert.Nil(t, err)
+	cl := l.(*consulLocator)
+
+	assert.True(t, awaitChange(cl.Changes()), "initial sync should signal a change")
+	cl.mutex.RLock()
+	targets := cl.targets
+	cl.mutex.RUnlock()
+	// the service address is preferred to the node address, and service metadata become labels
+	assert.Equal(t, []*locator.Target{
+		{Address: "http://10.0.0.1:9090", Labels: map[string]string{"replica": "a"}},
+		{Address: "http://10.0.1.2:9091", Labels: map[string]string{"replica": "b"}},
+	}, targets)
+
+	fake.set(unhealthyEntries)
+	assert.True(t, awaitChange(cl.Changes()), "service change should signal a change")
+	cl.mutex.RLock()
+	targets = cl.targets
+	cl.mutex.RUnlock()
+	assert.Equal(t, []*locator.Target{{
+		Address:        "http://10.0.0.1:9090",
+		Labels:         map[string]string{"replica": "a"},
+		NotReadyReason: "consul check 'ready' is critical",
+	}}, targets)
+
+	fake.mutex.Lock()
+	req := fake.requests[len(fake.requests)-1]
+	fake.mutex.Unlock()
+	assert.Equal(t, "primary", req.URL.Query().Get("tag"))
+	assert.Equal(t, "dc1", req.URL.Query().Get("dc"))
+	assert.Equal(t, "secret", req.Header.Get("X-Consul-Token"))
+	assert.NotEmpty(t, req.URL.Query().Get("index"))
+}
+
+func TestInvalidArguments(t *testing.T) {
+	_, err := NewConsulLocator("http://localhost:8500", "", "", "", "", "", false)
+	assert.NotNil(t, err)
+	_, err = NewConsulLocator("localhost", "prometheus", "", "", "", "", false)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,2 @@
+// Package consullocator implements prometheus discovery via the consul catalog
+package consullocator // import "github.com/matt-deboer/mpp/pkg/locator/consullocator"
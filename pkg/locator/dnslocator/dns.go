@@ -0,0 +1,146 @@
+package dnslocator
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	log "github.com/sirupsen/logrus"
+)
+
+const lookupTimeout = 5 * time.Second
+
+type dnsLocator struct {
+	srvNames          []string
+	aNames            []string
+	scheme            string
+	resolveSRVTargets bool
+	resolver          *net.Resolver
+}
+
+func (dl *dnsLocator) String() string {
+	return fmt.Sprintf("%T{srv: %v, a: %v}", dl, dl.srvNames, dl.aNames)
+}
+
+// NewDNSLocator generates a new DNS prometheus locator, which resolves the provided SRV record
+// names (e.g., '_web._tcp.prometheus.svc') and A/AAAA record names with fixed port (e.g., 'prometheus.svc:9090');
+// if resolverAddress ('host:port') is specified, lookups are performed against that DNS server
+// rather than the system-configured resolver. The target hosts of SRV records are used as-is,
+// unless resolveSRVTargets is set, in which case they are resolved to their addresses; this
+// is not supported for the https scheme, as certificates are verified against the host name
+func NewDNSLocator(srvNames, aNames []string, resolverAddress, scheme string, resolveSRVTargets bool) (locator.Locator, error) {
+
+	if len(srvNames) == 0 && len(aNames) == 0 {
+		return nil, fmt.Errorf("At least one SRV or A record name is required")
+	}
+	for _, name := range aNames {
+		if _, _, err := splitHostPort(name); err != nil {
+			return nil, err
+		}
+	}
+	if len(scheme) == 0 {
+		scheme = "http"
+	}
+	if resolveSRVTargets && scheme == "https" {
+		log.Warnf("Not resolving the target hosts of SRV records, as certificates of https endpoints are verified against them")
+		resolveSRVTargets = false
+	}
+
+	resolver := net.DefaultResolver
+	if len(resolverAddress) > 0 {
+		if _, _, err := net.SplitHostPort(resolverAddress); err != nil {
+			return nil, fmt.Errorf("Invalid resolver address '%s': %v", resolverAddress, err)
+		}
+		log.Infof("Using DNS resolver %s", resolverAddress)
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, resolverAddress)
+			},
+		}
+	}
+
+	return &dnsLocator{
+		srvNames:          srvNames,
+		aNames:            aNames,
+		scheme:            scheme,
+		resolveSRVTargets: resolveSRVTargets,
+		resolver:          resolver,
+	}, nil
+}
+
+func splitHostPort(name string) (string, int, error) {
+	host, portString, err := net.SplitHostPort(name)
+	if err != nil {
+		return "", 0, fmt.Errorf("Invalid A record name '%s'; expected 'name:port': %v", name, err)
+	}
+	port, err := strconv.Atoi(portString)
+	if err != nil {
+		return "", 0, fmt.Errorf("Invalid port for A record name '%s': %v", name, err)
+	}
+	return host, port, nil
+}
+
+// Endpoints provides a list of candidate prometheus endpoints
+func (dl *dnsLocator) Endpoints() ([]*locator.PrometheusEndpoint, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+	return locator.ProbeTargets(dl.targets(ctx))
+}
+
+func (dl *dnsLocator) targets(ctx context.Context) []*locator.Target {
+	targets := []*locator.Target{}
+	for _, name := range dl.srvNames {
+		_, records, err := dl.resolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			log.Errorf("Failed to resolve SRV record '%s': %v", name, err)
+			continue
+		}
+		for _, srv := range records {
+			host := strings.TrimSuffix(srv.Target, ".")
+			if dl.resolveSRVTargets {
+				targets = append(targets, dl.resolveHost(ctx, name, host, int(srv.Port))...)
+			} else {
+				targets = append(targets, dl.target(name, host, host, int(srv.Port)))
+			}
+		}
+	}
+	for _, name := range dl.aNames {
+		host, port, _ := splitHostPort(name)
+		targets = append(targets, dl.resolveHost(ctx, name, host, port)...)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].Address < targets[j].Address
+	})
+	return targets
+}
+
+// resolveHost resolves the provided host using the locator's resolver (which may
+// differ from the one used when proxying requests), returning a target per address
+func (dl *dnsLocator) resolveHost(ctx context.Context, name, host string, port int) []*locator.Target {
+	addrs, err := dl.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		log.Errorf("Failed to resolve '%s' (from '%s'): %v", host, name, err)
+		return nil
+	}
+	targets := make([]*locator.Target, 0, len(addrs))
+	for _, addr := range addrs {
+		targets = append(targets, dl.target(name, host, addr.IP.String(), port))
+	}
+	return targets
+}
+
+// target returns a target for the provided address (a host name or IP), labelled with the
+// record name and host from which it was located
+func (dl *dnsLocator) target(name, host, addr string, port int) *locator.Target {
+	return &locator.Target{
+		Address: fmt.Sprintf("%s://%s", dl.scheme, net.JoinHostPort(addr, strconv.Itoa(port))),
+		Labels:  map[string]string{"dns_name": name, "host": host},
+	}
+}
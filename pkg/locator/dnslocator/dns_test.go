@@ -0,0 +1,163 @@
+package dnslocator
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// mockDNSServer answers SRV and A queries from fixed records over UDP
+type mockDNSServer struct {
+	conn net.PacketConn
+	srv  map[string][]dnsmessage.SRVResource
+	a    map[string][][4]byte
+}
+
+func newMockDNSServer(t *testing.T) *mockDNSServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &mockDNSServer{
+		conn: conn,
+		srv: map[string][]dnsmessage.SRVResource{
+			"_web._tcp.prometheus.test.": {
+				{Priority: 10, Weight: 50, Port: 9090, Target: mustName(t, "prometheus-1.prometheus.test.")},
+				{Priority: 10, Weight: 50, Port: 9091, Target: mustName(t, "prometheus-0.prometheus.test.")},
+			},
+		},
+		a: map[string][][4]byte{
+			"prometheus-0.prometheus.test.": {{10, 0, 0, 1}},
+			"prometheus-1.prometheus.test.": {{10, 0, 0, 2}},
+			"prometheus.test.":              {{10, 0, 1, 2}, {10, 0, 1, 1}},
+		},
+	}
+	go s.serve()
+	return s
+}
+
+func mustName(t *testing.T, name string) dnsmessage.Name {
+	n, err := dnsmessage.NewName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func (s *mockDNSServer) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		// only the question is parsed, as the additional (EDNS) records sent
+		// by some resolvers are not supported by the parser
+		var p dnsmessage.Parser
+		h, err := p.Start(buf[:n])
+		if err != nil {
+			continue
+		}
+		q, err := p.Question()
+		if err != nil {
+			continue
+		}
+		resp := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: h.ID, Response: true, Authoritative: true},
+			Questions: []dnsmessage.Question{q},
+		}
+		name := strings.ToLower(q.Name.String())
+		switch q.Type {
+		case dnsmessage.TypeSRV:
+			for i := range s.srv[name] {
+				resp.Answers = append(resp.Answers, dnsmessage.Resource{
+					Header: dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 5},
+					Body:   &s.srv[name][i],
+				})
+			}
+		case dnsmessage.TypeA:
+			for _, a := range s.a[name] {
+				resp.Answers = append(resp.Answers, dnsmessage.Resource{
+					Header: dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 5},
+					Body:   &dnsmessage.AResource{A: a},
+				})
+			}
+		}
+		if _, known := s.a[name]; !known && len(resp.Answers) == 0 && q.Type != dnsmessage.TypeAAAA {
+			resp.RCode = dnsmessage.RCodeNameError
+		}
+		packed, err := resp.Pack()
+		if err == nil {
+			s.conn.WriteTo(packed, addr)
+		}
+	}
+}
+
+func (s *mockDNSServer) Close() {
+	s.conn.Close()
+}
+
+func addresses(dl *dnsLocator) []string {
+	var addrs []string
+	for _, target := range dl.targets(context.Background()) {
+		addrs = append(addrs, target.Address)
+	}
+	return addrs
+}
+
+func TestSRVLookup(t *testing.T) {
+	server := newMockDNSServer(t)
+	defer server.Close()
+
+	loc, err := NewDNSLocator([]string{"_web._tcp.prometheus.test."}, nil, server.conn.LocalAddr().String(), "", false)
+	assert.NoError(t, err)
+	dl := loc.(*dnsLocator)
+	assert.Equal(t, []string{"http://prometheus-0.prometheus.test:9091", "http://prometheus-1.prometheus.test:9090"},
+		addresses(dl))
+
+	targets := dl.targets(context.Background())
+	assert.Equal(t, "_web._tcp.prometheus.test.", targets[0].Labels["dns_name"])
+	assert.Equal(t, "prometheus-0.prometheus.test", targets[0].Labels["host"])
+}
+
+func TestSRVLookupResolvingTargets(t *testing.T) {
+	server := newMockDNSServer(t)
+	defer server.Close()
+
+	loc, err := NewDNSLocator([]string{"_web._tcp.prometheus.test."}, nil, server.conn.LocalAddr().String(), "", true)
+	assert.NoError(t, err)
+	dl := loc.(*dnsLocator)
+	assert.Equal(t, []string{"http://10.0.0.1:9091", "http://10.0.0.2:9090"}, addresses(dl))
+
+	targets := dl.targets(context.Background())
+	assert.Equal(t, "prometheus-0.prometheus.test", targets[0].Labels["host"])
+
+	// host names are retained for https, for certificates to be verified against them
+	loc, err = NewDNSLocator([]string{"_web._tcp.prometheus.test."}, nil, server.conn.LocalAddr().String(), "https", true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://prometheus-0.prometheus.test:9091", "https://prometheus-1.prometheus.test:9090"},
+		addresses(loc.(*dnsLocator)))
+}
+
+func TestALookup(t *testing.T) {
+	server := newMockDNSServer(t)
+	defer server.Close()
+
+	loc, err := NewDNSLocator(nil, []string{"prometheus.test.:9090", "missing.test.:9090"},
+		server.conn.LocalAddr().String(), "https", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://10.0.1.1:9090", "https://10.0.1.2:9090"}, addresses(loc.(*dnsLocator)))
+}
+
+func TestInvalidNames(t *testing.T) {
+	_, err := NewDNSLocator(nil, nil, "", "", false)
+	assert.Error(t, err)
+	_, err = NewDNSLocator(nil, []string{"prometheus.test"}, "", "", false)
+	assert.Error(t, err)
+	_, err = NewDNSLocator([]string{"_web._tcp.prometheus.test"}, nil, "not-an-address", "", false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,2 @@
+// Package dnslocator implements prometheus discovery via DNS SRV and A/AAAA records
+package dnslocator // import "github.com/matt-deboer/mpp/pkg/locator/dnslocator"
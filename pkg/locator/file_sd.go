@@ -0,0 +1,117 @@
+package locator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+var (
+	splitter = regexp.MustCompile("\r?\n")
+)
+
+const (
+	// schemeLabel is the (prometheus-compatible) label used to specify the
+	// scheme of targets which are provided as 'host:port'
+	schemeLabel = "__scheme__"
+	// metaLabelPrefix marks labels which are used only during discovery,
+	// and are not attached to the resulting endpoints
+	metaLabelPrefix = "__"
+)
+
+// TargetGroup is a set of targets sharing a common set of labels, in the format
+// used by prometheus' file_sd_configs
+type TargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	// Weight optionally sets the relative weight of the group's targets, as an
+	// alternative to the 'weight' label; it is not part of the file_sd format
+	Weight *float64 `json:"weight,omitempty"`
+}
+
+// ReadEndpointsFile reads the targets contained in the provided file; files ending
+// in '.json', '.yml' or '.yaml' are parsed as a list of target groups, while
+// all others are expected to contain one endpoint URL per line, optionally
+// followed by its weight, as 'weight={weight}'
+func ReadEndpointsFile(endpointsFile string) ([]*Target, error) {
+	b, err := ioutil.ReadFile(endpointsFile)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(endpointsFile)) {
+	case ".json", ".yml", ".yaml":
+		return ParseTargetGroups(b)
+	default:
+		return parseEndpointsList(b)
+	}
+}
+
+func parseEndpointsList(b []byte) ([]*Target, error) {
+	var targets []*Target
+	for _, line := range splitter.Split(strings.Trim(string(b), "\n"), -1) {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		target := &Target{Address: fields[0]}
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, WeightLabel+"=") {
+				return nil, fmt.Errorf("Invalid endpoint '%s'; expected {url} [weight={weight}]", line)
+			}
+			target.Labels = map[string]string{WeightLabel: strings.TrimPrefix(field, WeightLabel+"=")}
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// ParseTargetGroups parses a list of target groups in prometheus' file_sd_configs
+// format (either JSON or YAML), returning the resulting flattened list of targets
+func ParseTargetGroups(b []byte) ([]*Target, error) {
+	var groups []*TargetGroup
+	if err := yaml.Unmarshal(b, &groups); err != nil {
+		return nil, fmt.Errorf("Failed to parse target groups: %v", err)
+	}
+	return TargetGroupsToTargets(groups)
+}
+
+// TargetGroupsToTargets flattens the provided target groups into a list of targets;
+// targets specified as 'host:port' are given the scheme named by the '__scheme__'
+// label (defaulting to 'http'), and labels beginning with '__' are discarded; a group's
+// weight (if any) is attached as the 'weight' label
+func TargetGroupsToTargets(groups []*TargetGroup) ([]*Target, error) {
+	var targets []*Target
+	for i, group := range groups {
+		if group == nil {
+			continue
+		}
+		scheme := "http"
+		labels := make(map[string]string, len(group.Labels))
+		for name, value := range group.Labels {
+			if name == schemeLabel {
+				scheme = value
+			} else if !strings.HasPrefix(name, metaLabelPrefix) {
+				labels[name] = value
+			}
+		}
+		if group.Weight != nil {
+			labels[WeightLabel] = strconv.FormatFloat(*group.Weight, 'f', -1, 64)
+		}
+		for _, t := range group.Targets {
+			addr := strings.Trim(t, " ")
+			if len(addr) == 0 {
+				return nil, fmt.Errorf("Target group %d contains an empty target", i)
+			}
+			if !strings.Contains(addr, "://") {
+				addr = fmt.Sprintf("%s://%s", scheme, addr)
+			}
+			targets = append(targets, &Target{Address: addr, Labels: labels})
+		}
+	}
+	return targets, nil
+}
@@ -0,0 +1,81 @@
+package locator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const jsonTargetGroups = `[
+	{
+		"targets": ["10.0.0.1:9090", "10.0.0.2:9090"],
+		"labels": {"replica": "a", "zone": "us-east-1a"}
+	},
+	{
+		"targets": ["prometheus-b.example.com:443"],
+		"labels": {"replica": "b", "__scheme__": "https"},
+		"weight": 3
+	}
+]`
+
+const yamlTargetGroups = `
+- targets:
+  - 10.0.0.1:9090
+  labels:
+    replica: a
+- targets:
+  - https://prometheus-b.example.com
+`
+
+func TestParseTargetGroupsJSON(t *testing.T) {
+	targets, err := ParseTargetGroups([]byte(jsonTargetGroups))
+	assert.NoError(t, err)
+	assert.Len(t, targets, 3)
+	assert.Equal(t, "http://10.0.0.1:9090", targets[0].Address)
+	assert.Equal(t, map[string]string{"replica": "a", "zone": "us-east-1a"}, targets[1].Labels)
+	assert.Equal(t, "https://prometheus-b.example.com:443", targets[2].Address)
+	assert.Equal(t, map[string]string{"replica": "b", "weight": "3"}, targets[2].Labels)
+}
+
+func TestParseTargetGroupsYAML(t *testing.T) {
+	targets, err := ParseTargetGroups([]byte(yamlTargetGroups))
+	assert.NoError(t, err)
+	assert.Len(t, targets, 2)
+	assert.Equal(t, "http://10.0.0.1:9090", targets[0].Address)
+	assert.Equal(t, "a", targets[0].Labels["replica"])
+	assert.Equal(t, "https://prometheus-b.example.com", targets[1].Address)
+	assert.Empty(t, targets[1].Labels)
+}
+
+func TestReadEndpointsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mpp-endpoints")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	listFile := filepath.Join(dir, "endpoints")
+	assert.NoError(t, ioutil.WriteFile(listFile, []byte("http://10.0.0.1:9090\n\n http://10.0.0.2:9090  weight=3 \n"), 0644))
+	targets, err := ReadEndpointsFile(listFile)
+	assert.NoError(t, err)
+	assert.Len(t, targets, 2)
+	assert.Equal(t, "http://10.0.0.2:9090", targets[1].Address)
+	assert.Equal(t, map[string]string{"weight": "3"}, targets[1].Labels)
+	assert.Equal(t, float64(3), (&PrometheusEndpoint{Labels: targets[1].Labels}).Weight())
+	assert.Equal(t, float64(1), (&PrometheusEndpoint{Labels: targets[0].Labels}).Weight())
+
+	assert.NoError(t, ioutil.WriteFile(listFile, []byte("http://10.0.0.1:9090 replica=a\n"), 0644))
+	_, err = ReadEndpointsFile(listFile)
+	assert.Error(t, err)
+
+	jsonFile := filepath.Join(dir, "endpoints.json")
+	assert.NoError(t, ioutil.WriteFile(jsonFile, []byte(jsonTargetGroups), 0644))
+	targets, err = ReadEndpointsFile(jsonFile)
+	assert.NoError(t, err)
+	assert.Len(t, targets, 3)
+
+	assert.NoError(t, ioutil.WriteFile(jsonFile, []byte(`{"targets": "not-a-list"}`), 0644))
+	_, err = ReadEndpointsFile(jsonFile)
+	assert.Error(t, err)
+}
@@ -0,0 +1,2 @@
+// Package httpsdlocator implements prometheus discovery via an HTTP endpoint serving prometheus' http_sd format
+package httpsdlocator // import "github.com/matt-deboer/mpp/pkg/locator/httpsdlocator"
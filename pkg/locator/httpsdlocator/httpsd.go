@@ -0,0 +1,127 @@
+package httpsdlocator
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	log "github.com/sirupsen/logrus"
+)
+
+const requestTimeout = 10 * time.Second
+
+type httpSDLocator struct {
+	client        *http.Client
+	url           string
+	authorization string
+	// the most recent valid response
+	mutex   sync.Mutex
+	etag    string
+	targets []*locator.Target
+}
+
+func (hl *httpSDLocator) String() string {
+	return fmt.Sprintf("%T{url: %s}", hl, hl.url)
+}
+
+// NewHTTPSDLocator generates a new locator which fetches target groups, in the format used by
+// prometheus' http_sd_configs, from sdURL; if authorization is specified, it is sent as the
+// value of the 'Authorization' header
+func NewHTTPSDLocator(sdURL, authorization string, insecure bool) (locator.Locator, error) {
+	u, err := url.Parse(sdURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return nil, fmt.Errorf("Invalid http service-discovery URL '%s'", sdURL)
+	}
+	client := &http.Client{Timeout: requestTimeout}
+	if insecure {
+		client.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+	return &httpSDLocator{
+		client:        client,
+		url:           sdURL,
+		authorization: authorization,
+	}, nil
+}
+
+// Endpoints provides a list of candidate prometheus endpoints
+func (hl *httpSDLocator) Endpoints() ([]*locator.PrometheusEndpoint, error) {
+	targets, err := hl.currentTargets()
+	if err != nil {
+		return nil, err
+	}
+	return locator.ProbeTargets(targets)
+}
+
+// currentTargets fetches the target groups, returning the most recent valid targets
+// if they have not changed, or cannot be fetched
+func (hl *httpSDLocator) currentTargets() ([]*locator.Target, error) {
+	hl.mutex.Lock()
+	defer hl.mutex.Unlock()
+
+	targets, etag, err := hl.fetch(hl.etag)
+	if err != nil {
+		if hl.targets == nil {
+			return nil, err
+		}
+		log.Errorf("Failed to fetch targets from %s; using last valid targets: %v", hl.url, err)
+		return hl.targets, nil
+	}
+	if targets != nil {
+		hl.targets = targets
+		hl.etag = etag
+	}
+	return hl.targets, nil
+}
+
+// fetch requests the target groups, sending the ETag of the previous response (if any) in
+// the 'If-None-Match' header; nil targets are returned if the target groups are unchanged
+func (hl *httpSDLocator) fetch(etag string) ([]*locator.Target, string, error) {
+	req, err := http.NewRequest("GET", hl.url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	if len(hl.authorization) > 0 {
+		req.Header.Set("Authorization", hl.authorization)
+	}
+	if len(etag) > 0 {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := hl.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if log.GetLevel() >= log.DebugLevel {
+			log.Debugf("Targets from %s are unchanged (ETag: %s)", hl.url, etag)
+		}
+		return nil, etag, nil
+	case http.StatusOK:
+	default:
+		return nil, "", fmt.Errorf("GET %s returned %s", hl.url, resp.Status)
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	targets, err := locator.ParseTargetGroups(b)
+	if err != nil {
+		return nil, "", err
+	}
+	if targets == nil {
+		// an empty list of target groups is valid
+		targets = []*locator.Target{}
+	}
+	return targets, resp.Header.Get("ETag"), nil
+}
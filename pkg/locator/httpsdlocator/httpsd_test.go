@@ -0,0 +1,110 @@
+package httpsdlocator
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSD serves a fixed set of target groups, honoring 'If-None-Match'
+type fakeSD struct {
+	mutex    sync.Mutex
+	etag     string
+	body     string
+	status   int
+	modified int
+	requests []*http.Request
+}
+
+func (s *fakeSD) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.requests = append(s.requests, req)
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+	if req.Header.Get("If-None-Match") == s.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	s.modified++
+	w.Header().Set("ETag", s.etag)
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, s.body)
+}
+
+func (s *fakeSD) set(etag, body string, status int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.etag, s.body, s.status = etag, body, status
+}
+
+func addresses(targets []*locator.Target) []string {
+	addrs := make([]string, len(targets))
+	for i, target := range targets {
+		addrs[i] = target.Address
+	}
+	return addrs
+}
+
+func TestFetchTargets(t *testing.T) {
+	fake := &fakeSD{}
+	fake.set(`"v1"`, `[{"targets": ["10.0.0.1:9090", "10.0.0.2:9090"],
+		"labels": {"replica": "a", "__meta_cmdb_id": "1234"}}]`, 0)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	l, err := NewHTTPSDLocator(server.URL+"/targets", "Bearer secret", false)
+	assert.Nil(t, err)
+	hl := l.(*httpSDLocator)
+
+	targets, err := hl.currentTargets()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"http://10.0.0.1:9090", "http://10.0.0.2:9090"}, addresses(targets))
+	assert.Equal(t, map[string]string{"replica": "a"}, targets[0].Labels)
+
+	// unchanged; the cached targets are returned
+	targets, err = hl.currentTargets()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"http://10.0.0.1:9090", "http://10.0.0.2:9090"}, addresses(targets))
+	assert.Equal(t, 1, fake.modified)
+	assert.Equal(t, `"v1"`, fake.requests[1].Header.Get("If-None-Match"))
+	assert.Equal(t, "Bearer secret", fake.requests[1].Header.Get("Authorization"))
+
+	fake.set(`"v2"`, `[{"targets": ["10.0.0.3:9090"], "labels": {"__scheme__": "https"}}]`, 0)
+	targets, err = hl.currentTargets()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://10.0.0.3:9090"}, addresses(targets))
+
+	// failures retain the last valid targets
+	fake.set(`"v3"`, "", http.StatusInternalServerError)
+	targets, err = hl.currentTargets()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://10.0.0.3:9090"}, addresses(targets))
+
+	fake.set(`"v4"`, `[]`, 0)
+	targets, err = hl.currentTargets()
+	assert.Nil(t, err)
+	assert.Empty(t, targets)
+}
+
+func TestFetchFailsWithoutValidTargets(t *testing.T) {
+	fake := &fakeSD{}
+	fake.set(`"v1"`, `{"not": "a list"}`, 0)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	l, err := NewHTTPSDLocator(server.URL, "", false)
+	assert.Nil(t, err)
+	_, err = l.(*httpSDLocator).currentTargets()
+	assert.NotNil(t, err)
+
+	_, err = NewHTTPSDLocator("ftp://example.com/targets", "", false)
+	assert.NotNil(t, err)
+}
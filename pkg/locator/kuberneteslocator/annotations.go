@@ -0,0 +1,120 @@
+package kuberneteslocator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	apiv1 "github.com/ericchiang/k8s/api/v1"
+	"github.com/matt-deboer/mpp/pkg/locator"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// schemeAnnotation specifies the scheme ('http' or 'https') used to reach prometheus
+	schemeAnnotation = "mpp.io/scheme"
+	// portAnnotation specifies the port (name or number) on which prometheus is listening,
+	// overriding the 'kube-port' flag
+	portAnnotation = "mpp.io/port"
+	// pathAnnotation specifies the path prefix (i.e., '--web.route-prefix') under which prometheus is served
+	pathAnnotation = "mpp.io/path"
+	// weightAnnotation specifies the relative weight of the endpoint, used by weighted strategies
+	weightAnnotation = "mpp.io/weight"
+)
+
+// endpointSettings describes how the URL of a prometheus endpoint is constructed
+type endpointSettings struct {
+	scheme     string
+	portName   string
+	portNumber int32
+	path       string
+	weight     string
+}
+
+// settingsFor returns the endpoint settings for a pod or service with the provided annotations,
+// falling back to the locator's defaults
+func (k *kubeLocator) settingsFor(annotations map[string]string) *endpointSettings {
+	settings := &endpointSettings{
+		scheme:     "http",
+		portName:   k.portName,
+		portNumber: k.portNumber,
+	}
+	if scheme, ok := annotations[schemeAnnotation]; ok {
+		scheme = strings.ToLower(strings.TrimSpace(scheme))
+		if scheme == "http" || scheme == "https" {
+			settings.scheme = scheme
+		} else {
+			log.Warnf("Ignoring invalid value for annotation %s: '%s'", schemeAnnotation, scheme)
+		}
+	}
+	if port, ok := annotations[portAnnotation]; ok {
+		port = strings.TrimSpace(port)
+		portNumber, _ := strconv.ParseInt(port, 10, 32)
+		settings.portName = port
+		settings.portNumber = int32(portNumber)
+	}
+	if path, ok := annotations[pathAnnotation]; ok {
+		path = strings.Trim(strings.TrimSpace(path), "/")
+		if len(path) > 0 {
+			settings.path = "/" + path
+		}
+	}
+	if weight, ok := annotations[weightAnnotation]; ok {
+		weight = strings.TrimSpace(weight)
+		if value, err := strconv.ParseFloat(weight, 64); err == nil && value >= 0 {
+			settings.weight = weight
+		} else {
+			log.Warnf("Ignoring invalid value for annotation %s: '%s'", weightAnnotation, weight)
+		}
+	}
+	return settings
+}
+
+// labels returns the labels attached to targets built with these settings
+func (s *endpointSettings) labels() map[string]string {
+	if len(s.weight) == 0 {
+		return nil
+	}
+	return map[string]string{locator.WeightLabel: s.weight}
+}
+
+// address builds the URL for the prometheus endpoint at the provided ip and port
+func (s *endpointSettings) address(ip string, port int32) string {
+	return fmt.Sprintf("%s://%s:%d%s", s.scheme, ip, port, s.path)
+}
+
+func (s *endpointSettings) subsetPort(subset *apiv1.EndpointSubset) int32 {
+	for _, p := range subset.Ports {
+		if p.GetProtocol() == "TCP" {
+			if len(s.portName) > 0 {
+				if s.portName == p.GetName() || p.GetPort() == s.portNumber {
+					// port was specified; match by name or port value
+					return p.GetPort()
+				}
+			} else {
+				// port not specified; take the first (TCP) port we found
+				return p.GetPort()
+			}
+		}
+	}
+	return 0
+}
+
+func (s *endpointSettings) podPort(pod *apiv1.Pod) int32 {
+	for _, c := range pod.Spec.GetContainers() {
+		for _, p := range c.Ports {
+			if p.GetProtocol() == "TCP" {
+				if len(s.portName) > 0 {
+					if s.portName == p.GetName() || p.GetContainerPort() == s.portNumber {
+						// port was specified; match by name or port value
+						return p.GetContainerPort()
+					}
+				} else {
+					// port not specified; take the first (TCP) port we found
+					return p.GetContainerPort()
+				}
+			}
+		}
+	}
+	return 0
+}
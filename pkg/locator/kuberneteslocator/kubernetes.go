@@ -1,32 +1,65 @@
 package kuberneteslocator
 
 import (
-	"context"
 	"fmt"
 	"io/ioutil"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/ericchiang/k8s"
+	apiv1 "github.com/ericchiang/k8s/api/v1"
 	"github.com/ghodss/yaml"
 	"github.com/matt-deboer/mpp/pkg/locator"
 	log "github.com/sirupsen/logrus"
 )
 
 type kubeLocator struct {
-	labelSelector k8s.Option
-	portName      string
-	portNumber    int32
-	namespace     string
-	serviceName   string
-	client        *k8s.Client
+	selector    labelSelector
+	portName    string
+	portNumber  int32
+	namespaces  []string
+	serviceName string
+	client      *k8s.Client
+	// watch-backed state, keyed by namespace; a namespace is present once its watch has synced
+	mutex   sync.RWMutex
+	targets map[string][]*locator.Target
+	changes chan struct{}
 }
 
-// NewKubernetesLocator generates a new marathon prometheus locator
-func NewKubernetesLocator(kubeconfig, namespace, labelSelector, port, serviceName string) (locator.Locator, error) {
+func (k *kubeLocator) String() string {
+	namespaces := make([]string, len(k.namespaces))
+	for i, namespace := range k.namespaces {
+		namespaces[i] = namespaceName(namespace)
+	}
+	if len(k.serviceName) > 0 {
+		return fmt.Sprintf("%T{namespaces: %v, service: %s}", k, namespaces, k.serviceName)
+	}
+	return fmt.Sprintf("%T{namespaces: %v, selector: %v}", k, namespaces, k.selector)
+}
+
+// namespaceName returns a printable name for the namespace, which is '*' for all namespaces
+func namespaceName(namespace string) string {
+	if namespace == k8s.AllNamespaces {
+		return "*"
+	}
+	return namespace
+}
+
+// NewKubernetesLocator generates a new kubernetes prometheus locator, searching the provided
+// namespaces; a namespace of '*' searches all namespaces
+func NewKubernetesLocator(kubeconfig string, namespaces []string, labelSelector, port, serviceName string) (locator.Locator, error) {
+
+	selector, err := parseLabelSelector(labelSelector)
+	if err != nil {
+		return nil, err
+	}
+	if len(namespaces) == 0 {
+		return nil, fmt.Errorf("At least one namespace is required")
+	}
+	namespaces = uniqueNamespaces(namespaces)
 
 	var client *k8s.Client
-	var err error
 	if len(kubeconfig) > 0 {
 		data, err := ioutil.ReadFile(kubeconfig)
 		if err != nil {
@@ -52,88 +85,159 @@ func NewKubernetesLocator(kubeconfig, namespace, labelSelector, port, serviceNam
 		}
 	}
 
-	ls := new(k8s.LabelSelector)
-	if len(labelSelector) > 0 {
-		for _, part := range strings.Split(labelSelector, ",") {
-			if strings.Contains(part, "=") {
-				eq := strings.Split(part, "=")
-				ls.Eq(eq[0], strings.Join(eq[1:], "="))
-			}
-		}
-	}
-
 	portNumber, _ := strconv.ParseInt(port, 10, 32)
 
-	return &kubeLocator{
-		client:        client,
-		labelSelector: ls.Selector(),
-		namespace:     namespace,
-		portName:      port,
-		portNumber:    int32(portNumber),
-		serviceName:   serviceName,
-	}, nil
+	k := &kubeLocator{
+		client:      client,
+		selector:    selector,
+		namespaces:  namespaces,
+		portName:    port,
+		portNumber:  int32(portNumber),
+		serviceName: serviceName,
+		targets:     make(map[string][]*locator.Target),
+		changes:     make(chan struct{}, 1),
+	}
+	for _, namespace := range namespaces {
+		go k.watch(namespace)
+	}
+	return k, nil
+}
+
+// uniqueNamespaces removes duplicate namespaces; if any namespace is '*', only
+// the all-namespaces entry is returned
+func uniqueNamespaces(namespaces []string) []string {
+	unique := []string{}
+	seen := make(map[string]bool)
+	for _, namespace := range namespaces {
+		namespace = strings.TrimSpace(namespace)
+		if namespace == "*" {
+			return []string{k8s.AllNamespaces}
+		}
+		if !seen[namespace] {
+			seen[namespace] = true
+			unique = append(unique, namespace)
+		}
+	}
+	return unique
 }
 
 // Endpoints provides a list of candidate prometheus endpoints
 func (k *kubeLocator) Endpoints() ([]*locator.PrometheusEndpoint, error) {
+	targets := []*locator.Target{}
+	var lastErr error
+	failed := 0
+	for _, namespace := range k.namespaces {
+		k.mutex.RLock()
+		cached, synced := k.targets[namespace]
+		k.mutex.RUnlock()
+		if synced {
+			targets = append(targets, cached...)
+			continue
+		}
+		// the watch has not (yet) been established; fall back to polling
+		polled, err := k.pollTargets(namespace)
+		if err != nil {
+			log.Warnf("Failed to list targets in namespace %s: %v", namespaceName(namespace), err)
+			lastErr = err
+			failed++
+			continue
+		}
+		targets = append(targets, polled...)
+	}
+	if failed == len(k.namespaces) {
+		return nil, lastErr
+	}
+	return locator.ProbeTargets(targets)
+}
 
-	endpoints := []string{}
+func (k *kubeLocator) pollTargets(namespace string) ([]*locator.Target, error) {
 	if len(k.serviceName) > 0 {
-		endp, err := k.client.CoreV1().GetEndpoints(context.Background(), k.serviceName, k.namespace)
+		endpoints, _, err := k.listEndpoints(namespace, make(map[string]*apiv1.Service))
 		if err != nil {
 			return nil, err
 		}
-		var port int32
-		if len(endp.Subsets) > 0 {
-			for _, p := range endp.Subsets[0].Ports {
-				if p.GetProtocol() == "TCP" {
-					if len(k.portName) > 0 {
-						if k.portName == p.GetName() || p.GetPort() == k.portNumber {
-							// 'port' flag was specified; match by name or port value
-							port = p.GetPort()
-							break
-						}
-					} else {
-						// 'port' flag not specified; take the first (TCP) port we found
-						port = p.GetPort()
-						break
-					}
+		return k.endpointsTargets(endpoints), nil
+	}
+	pods, _, err := k.listPods(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return k.podTargets(pods), nil
+}
+
+// endpointsTargets builds the list of targets from the cached endpoints of the configured service,
+// including addresses from all subsets; not-ready addresses are included as not-ready targets
+func (k *kubeLocator) endpointsTargets(endpoints map[string]*apiv1.Endpoints) []*locator.Target {
+	targets := []*locator.Target{}
+	for _, key := range sortedKeys(endpoints) {
+		endp := endpoints[key]
+		settings := k.settingsFor(endp.Metadata.GetAnnotations())
+		for _, subset := range endp.Subsets {
+			port := settings.subsetPort(subset)
+			if port == 0 {
+				if log.GetLevel() >= log.DebugLevel {
+					log.Debugf("No matching port found in subset of endpoints %s", key)
 				}
+				continue
+			}
+			for _, a := range subset.Addresses {
+				targets = append(targets, &locator.Target{Address: settings.address(a.GetIp(), port),
+					Labels: settings.labels()})
 			}
-			for _, a := range endp.Subsets[0].Addresses {
-				endpoints = append(endpoints, fmt.Sprintf("http://%s:%d", a.GetIp(), port))
+			for _, a := range subset.NotReadyAddresses {
+				targets = append(targets, &locator.Target{Address: settings.address(a.GetIp(), port),
+					Labels: settings.labels(), NotReadyReason: "endpoint address is not ready"})
 			}
 		}
-	} else {
-		pods, err := k.client.CoreV1().ListPods(context.Background(), k.namespace, k.labelSelector)
-		if err != nil {
-			return nil, err
+	}
+	return targets
+}
+
+// podTargets builds the list of targets from the cached pods; pods which have no IP assigned
+// are skipped, while pods that are terminating or not ready are included as not-ready targets
+func (k *kubeLocator) podTargets(pods map[string]*apiv1.Pod) []*locator.Target {
+	targets := []*locator.Target{}
+	for _, key := range sortedPodKeys(pods) {
+		pod := pods[key]
+		if len(pod.Status.GetPodIP()) == 0 {
+			if log.GetLevel() >= log.DebugLevel {
+				log.Debugf("Skipping pod %s, which has no IP assigned", key)
+			}
+			continue
 		}
-		for _, pod := range pods.Items {
-			var port int32
-			for _, c := range pod.Spec.Containers {
-				for _, p := range c.Ports {
-					if p.GetProtocol() == "TCP" {
-						if len(k.portName) > 0 {
-							if k.portName == p.GetName() || p.GetContainerPort() == k.portNumber {
-								// 'port' flag was specified; match by name or port value
-								port = p.GetContainerPort()
-							}
-						} else {
-							// 'port' flag not specified; take the first (TCP) port we found
-							port = p.GetContainerPort()
-						}
-					}
-					if port > 0 {
-						break
-					}
-				}
-				if port > 0 {
-					break
-				}
+		settings := k.settingsFor(pod.Metadata.GetAnnotations())
+		port := settings.podPort(pod)
+		if port == 0 {
+			if log.GetLevel() >= log.DebugLevel {
+				log.Debugf("Skipping pod %s, which has no matching port", key)
+			}
+			continue
+		}
+		targets = append(targets, &locator.Target{
+			Address:        settings.address(pod.Status.GetPodIP(), port),
+			Labels:         settings.labels(),
+			NotReadyReason: podNotReadyReason(pod),
+		})
+	}
+	return targets
+}
+
+// podNotReadyReason returns a description of why the pod is not ready, or
+// the empty string if the pod is ready
+func podNotReadyReason(pod *apiv1.Pod) string {
+	if pod.Metadata.GetDeletionTimestamp() != nil {
+		return "pod is terminating"
+	}
+	if phase := pod.Status.GetPhase(); phase != "Running" {
+		return fmt.Sprintf("pod is %s", phase)
+	}
+	for _, condition := range pod.Status.GetConditions() {
+		if condition.GetType() == "Ready" {
+			if condition.GetStatus() == "True" {
+				return ""
 			}
-			endpoints = append(endpoints, fmt.Sprintf("http://%s:%d", pod.Status.GetPodIP(), port))
+			break
 		}
 	}
-	return locator.ToPrometheusClients(endpoints)
+	return "pod is not ready"
 }
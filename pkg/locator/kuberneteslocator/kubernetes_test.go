@@ -0,0 +1,114 @@
+package kuberneteslocator
+
+import (
+	"testing"
+
+	apiv1 "github.com/ericchiang/k8s/api/v1"
+	metav1 "github.com/ericchiang/k8s/apis/meta/v1"
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/stretchr/testify/assert"
+)
+
+func s(value string) *string {
+	return &value
+}
+
+func i32(value int32) *int32 {
+	return &value
+}
+
+func pod(name, ip, phase string, ready bool) *apiv1.Pod {
+	readyStatus := "False"
+	if ready {
+		readyStatus = "True"
+	}
+	return &apiv1.Pod{
+		Metadata: &metav1.ObjectMeta{Name: s(name), Namespace: s("monitoring")},
+		Spec: &apiv1.PodSpec{
+			Containers: []*apiv1.Container{
+				{Ports: []*apiv1.ContainerPort{
+					{Name: s("sidecar"), ContainerPort: i32(8080), Protocol: s("TCP")},
+					{Name: s("web"), ContainerPort: i32(9090), Protocol: s("TCP")},
+				}},
+			},
+		},
+		Status: &apiv1.PodStatus{
+			PodIP:      s(ip),
+			Phase:      s(phase),
+			Conditions: []*apiv1.PodCondition{{Type: s("Ready"), Status: s(readyStatus)}},
+		},
+	}
+}
+
+func summarize(targets []*locator.Target) map[string]string {
+	summary := make(map[string]string, len(targets))
+	for _, target := range targets {
+		summary[target.Address] = target.NotReadyReason
+	}
+	return summary
+}
+
+func TestPodTargets(t *testing.T) {
+	k := &kubeLocator{portName: "web"}
+
+	terminating := pod("prometheus-3", "10.0.0.4", "Running", true)
+	terminating.Metadata.DeletionTimestamp = &metav1.Time{}
+
+	annotated := pod("prometheus-4", "10.0.0.5", "Running", true)
+	annotated.Metadata.Annotations = map[string]string{
+		"mpp.io/scheme": "https",
+		"mpp.io/port":   "8080",
+		"mpp.io/path":   "/prometheus/",
+		"mpp.io/weight": "3",
+	}
+
+	targets := k.podTargets(map[string]*apiv1.Pod{
+		"monitoring/prometheus-0": pod("prometheus-0", "10.0.0.1", "Running", true),
+		"monitoring/prometheus-1": pod("prometheus-1", "10.0.0.2", "Running", false),
+		"monitoring/prometheus-2": pod("prometheus-2", "", "Pending", false),
+		"monitoring/prometheus-3": terminating,
+		"monitoring/prometheus-4": annotated,
+	})
+	assert.Equal(t, map[string]string{
+		"http://10.0.0.1:9090":             "",
+		"http://10.0.0.2:9090":             "pod is not ready",
+		"http://10.0.0.4:9090":             "pod is terminating",
+		"https://10.0.0.5:8080/prometheus": "",
+	}, summarize(targets))
+	for _, target := range targets {
+		if target.Address == "https://10.0.0.5:8080/prometheus" {
+			assert.Equal(t, map[string]string{"weight": "3"}, target.Labels)
+		} else {
+			assert.Nil(t, target.Labels)
+		}
+	}
+}
+
+func TestEndpointsTargets(t *testing.T) {
+	k := &kubeLocator{portName: "web"}
+
+	targets := k.endpointsTargets(map[string]*apiv1.Endpoints{
+		"monitoring/prometheus": {
+			Metadata: &metav1.ObjectMeta{Annotations: map[string]string{"mpp.io/path": "prometheus"}},
+			Subsets: []*apiv1.EndpointSubset{
+				{
+					Addresses:         []*apiv1.EndpointAddress{{Ip: s("10.0.0.1")}},
+					NotReadyAddresses: []*apiv1.EndpointAddress{{Ip: s("10.0.0.2")}},
+					Ports:             []*apiv1.EndpointPort{{Name: s("web"), Port: i32(9090), Protocol: s("TCP")}},
+				},
+				{
+					Addresses: []*apiv1.EndpointAddress{{Ip: s("10.0.1.1")}},
+					Ports: []*apiv1.EndpointPort{
+						{Name: s("sidecar"), Port: i32(8080), Protocol: s("TCP")},
+						{Name: s("web"), Port: i32(9091), Protocol: s("TCP")},
+					},
+				},
+			},
+		},
+	})
+	assert.Equal(t, map[string]string{
+		"http://10.0.0.1:9090/prometheus": "",
+		"http://10.0.0.2:9090/prometheus": "endpoint address is not ready",
+		"http://10.0.1.1:9091/prometheus": "",
+	}, summarize(targets))
+}
@@ -0,0 +1,179 @@
+package kuberneteslocator
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ericchiang/k8s"
+)
+
+const (
+	opEquals       = "="
+	opNotEquals    = "!="
+	opIn           = "in"
+	opNotIn        = "notin"
+	opExists       = "exists"
+	opDoesNotExist = "!"
+)
+
+var (
+	labelKeyRegexp   = regexp.MustCompile(`^([a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*/)?[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+	labelValueRegexp = regexp.MustCompile(`^(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])?$`)
+	setRequirement   = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+)
+
+// requirement is a single term of a label selector
+type requirement struct {
+	key      string
+	operator string
+	values   []string
+}
+
+// labelSelector is a parsed kubernetes label selector, supporting equality-based ('=', '==', '!=')
+// and set-based ('in', 'notin', existence) requirements
+type labelSelector []*requirement
+
+// parseLabelSelector parses the provided label selector string, returning an error
+// for any requirement which is not valid
+func parseLabelSelector(selector string) (labelSelector, error) {
+	var ls labelSelector
+	for _, term := range splitTerms(selector) {
+		term = strings.TrimSpace(term)
+		if len(term) == 0 {
+			continue
+		}
+		req, err := parseRequirement(term)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid label selector '%s': %v", selector, err)
+		}
+		ls = append(ls, req)
+	}
+	return ls, nil
+}
+
+// splitTerms splits the selector on commas which are not enclosed in parentheses
+func splitTerms(selector string) []string {
+	var terms []string
+	depth, start := 0, 0
+	for i, c := range selector {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				terms = append(terms, selector[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(terms, selector[start:])
+}
+
+func parseRequirement(term string) (*requirement, error) {
+	req := &requirement{}
+	if m := setRequirement.FindStringSubmatch(term); m != nil {
+		req.key, req.operator = m[1], m[2]
+		if len(strings.TrimSpace(m[3])) > 0 {
+			for _, value := range strings.Split(m[3], ",") {
+				req.values = append(req.values, strings.TrimSpace(value))
+			}
+		}
+	} else if strings.HasPrefix(term, "!") {
+		req.key, req.operator = strings.TrimSpace(term[1:]), opDoesNotExist
+	} else if parts := strings.SplitN(term, "!=", 2); len(parts) == 2 {
+		req.key, req.operator = strings.TrimSpace(parts[0]), opNotEquals
+		req.values = []string{strings.TrimSpace(parts[1])}
+	} else if parts := strings.SplitN(strings.Replace(term, "==", "=", 1), "=", 2); len(parts) == 2 {
+		req.key, req.operator = strings.TrimSpace(parts[0]), opEquals
+		req.values = []string{strings.TrimSpace(parts[1])}
+	} else {
+		req.key, req.operator = term, opExists
+	}
+
+	if len(req.key) > 253 || !labelKeyRegexp.MatchString(req.key) {
+		return nil, fmt.Errorf("invalid label key '%s'", req.key)
+	}
+	if (req.operator == opIn || req.operator == opNotIn) && len(req.values) == 0 {
+		return nil, fmt.Errorf("'%s' requires at least one value", req.operator)
+	}
+	for _, value := range req.values {
+		if len(value) > 63 || !labelValueRegexp.MatchString(value) {
+			return nil, fmt.Errorf("invalid label value '%s' for key '%s'", value, req.key)
+		}
+	}
+	return req, nil
+}
+
+func (r *requirement) matches(labels map[string]string) bool {
+	value, exists := labels[r.key]
+	switch r.operator {
+	case opEquals, opIn:
+		return exists && contains(r.values, value)
+	case opNotEquals, opNotIn:
+		return !exists || !contains(r.values, value)
+	case opExists:
+		return exists
+	case opDoesNotExist:
+		return !exists
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns true if the provided labels satisfy all requirements of the selector
+func (ls labelSelector) matches(labels map[string]string) bool {
+	for _, req := range ls {
+		if !req.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// option returns a list option performing server-side filtering using those requirements
+// which can be expressed through k8s.LabelSelector; as existence requirements (and empty values)
+// cannot be expressed, results must also be filtered using 'matches'
+func (ls labelSelector) option() k8s.Option {
+	s := new(k8s.LabelSelector)
+	for _, req := range ls {
+		switch req.operator {
+		case opEquals:
+			s.Eq(req.key, req.values[0])
+		case opNotEquals:
+			s.NotEq(req.key, req.values[0])
+		case opIn:
+			s.In(req.key, req.values...)
+		case opNotIn:
+			s.NotIn(req.key, req.values...)
+		}
+	}
+	return s.Selector()
+}
+
+func (ls labelSelector) String() string {
+	terms := make([]string, 0, len(ls))
+	for _, req := range ls {
+		switch req.operator {
+		case opExists:
+			terms = append(terms, req.key)
+		case opDoesNotExist:
+			terms = append(terms, "!"+req.key)
+		case opIn, opNotIn:
+			terms = append(terms, fmt.Sprintf("%s %s (%s)", req.key, req.operator, strings.Join(req.values, ",")))
+		default:
+			terms = append(terms, req.key+req.operator+req.values[0])
+		}
+	}
+	return strings.Join(terms, ",")
+}
@@ -0,0 +1,54 @@
+package kuberneteslocator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLabelSelector(t *testing.T) {
+	selector, err := parseLabelSelector("app=prometheus, tier in (primary, secondary),env!=dev,release notin (canary),team,!deprecated,role==server")
+	assert.Nil(t, err)
+	assert.Equal(t, "app=prometheus,tier in (primary,secondary),env!=dev,release notin (canary),team,!deprecated,role=server",
+		selector.String())
+
+	assert.True(t, selector.matches(map[string]string{
+		"app": "prometheus", "tier": "primary", "team": "sre", "role": "server"}))
+	assert.True(t, selector.matches(map[string]string{
+		"app": "prometheus", "tier": "secondary", "env": "prod", "release": "stable", "team": "sre", "role": "server"}))
+	// missing required 'team'
+	assert.False(t, selector.matches(map[string]string{"app": "prometheus", "tier": "primary", "role": "server"}))
+	// tier not in set
+	assert.False(t, selector.matches(map[string]string{"app": "prometheus", "tier": "other", "team": "sre", "role": "server"}))
+	// excluded env
+	assert.False(t, selector.matches(map[string]string{
+		"app": "prometheus", "tier": "primary", "env": "dev", "team": "sre", "role": "server"}))
+	// forbidden 'deprecated'
+	assert.False(t, selector.matches(map[string]string{
+		"app": "prometheus", "tier": "primary", "team": "sre", "role": "server", "deprecated": "true"}))
+}
+
+func TestParseLabelSelectorEmpty(t *testing.T) {
+	selector, err := parseLabelSelector("")
+	assert.Nil(t, err)
+	assert.Empty(t, selector)
+	assert.True(t, selector.matches(map[string]string{"app": "prometheus"}))
+}
+
+func TestParseLabelSelectorErrors(t *testing.T) {
+	for _, invalid := range []string{
+		"app=prom etheus",
+		"app in ()",
+		"-app=prometheus",
+		"app=a=b",
+		"tier in (primary, -secondary)",
+	} {
+		_, err := parseLabelSelector(invalid)
+		assert.NotNil(t, err, "expected an error for '%s'", invalid)
+	}
+}
+
+func TestUniqueNamespaces(t *testing.T) {
+	assert.Equal(t, []string{"monitoring", "default"}, uniqueNamespaces([]string{"monitoring", "default", "monitoring"}))
+	assert.Equal(t, []string{""}, uniqueNamespaces([]string{"monitoring", "*"}))
+}
@@ -0,0 +1,217 @@
+package kuberneteslocator
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/ericchiang/k8s"
+	apiv1 "github.com/ericchiang/k8s/api/v1"
+	"github.com/matt-deboer/mpp/pkg/locator"
+	log "github.com/sirupsen/logrus"
+)
+
+// watchRetryDelay is the time waited before re-listing after a watch is interrupted
+var watchRetryDelay = 5 * time.Second
+
+// Changes provides a channel which receives a value whenever the candidate endpoints change
+func (k *kubeLocator) Changes() <-chan struct{} {
+	return k.changes
+}
+
+// watch maintains the cached targets for a namespace by listing, and then watching, the relevant
+// kubernetes objects; the list is repeated, and the watch resumed, whenever the watch is interrupted
+func (k *kubeLocator) watch(namespace string) {
+	for {
+		var err error
+		if len(k.serviceName) > 0 {
+			err = k.listAndWatchEndpoints(namespace)
+		} else {
+			err = k.listAndWatchPods(namespace)
+		}
+		log.Warnf("Watch for %v in namespace %s was interrupted; re-listing in %s: %v",
+			k, namespaceName(namespace), watchRetryDelay, err)
+		time.Sleep(watchRetryDelay)
+	}
+}
+
+func objectKey(meta interface {
+	GetNamespace() string
+	GetName() string
+}) string {
+	return meta.GetNamespace() + "/" + meta.GetName()
+}
+
+// listEndpoints lists the endpoints of the configured service in the namespace, adding the annotations
+// of the service, which is fetched unless it is already present in the provided cache
+func (k *kubeLocator) listEndpoints(namespace string, services map[string]*apiv1.Service) (map[string]*apiv1.Endpoints, string, error) {
+	list, err := k.client.CoreV1().ListEndpoints(context.Background(), namespace)
+	if err != nil {
+		return nil, "", err
+	}
+	endpoints := make(map[string]*apiv1.Endpoints)
+	for _, endp := range list.Items {
+		if endp.Metadata.GetName() == k.serviceName {
+			k.addServiceAnnotations(endp, services)
+			endpoints[objectKey(endp.Metadata)] = endp
+		}
+	}
+	return endpoints, list.Metadata.GetResourceVersion(), nil
+}
+
+// addServiceAnnotations copies the annotations of the service owning the provided endpoints
+// onto the endpoints, so that they may be consulted when building targets; the service is
+// cached, such that it is fetched once per list rather than on every watch event
+func (k *kubeLocator) addServiceAnnotations(endp *apiv1.Endpoints, services map[string]*apiv1.Service) {
+	if endp.Metadata == nil {
+		return
+	}
+	key := objectKey(endp.Metadata)
+	svc, cached := services[key]
+	if !cached {
+		var err error
+		svc, err = k.client.CoreV1().GetService(context.Background(), endp.Metadata.GetName(), endp.Metadata.GetNamespace())
+		if err != nil {
+			log.Warnf("Failed to get service %s for its annotations: %v", key, err)
+			return
+		}
+		services[key] = svc
+	}
+	annotations := make(map[string]string)
+	for name, value := range svc.Metadata.GetAnnotations() {
+		annotations[name] = value
+	}
+	for name, value := range endp.Metadata.GetAnnotations() {
+		annotations[name] = value
+	}
+	endp.Metadata.Annotations = annotations
+}
+
+// listAndWatchEndpoints lists, and then watches, the endpoints of the configured service; the service
+// is fetched again on each list, so changes to its annotations are applied once the watch is resumed
+func (k *kubeLocator) listAndWatchEndpoints(namespace string) error {
+	services := make(map[string]*apiv1.Service)
+	endpoints, resourceVersion, err := k.listEndpoints(namespace, services)
+	if err != nil {
+		return err
+	}
+	k.update(namespace, k.endpointsTargets(endpoints))
+
+	watcher, err := k.client.CoreV1().WatchEndpoints(context.Background(), namespace,
+		k8s.ResourceVersion(resourceVersion))
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	for {
+		event, endp, err := watcher.Next()
+		if err != nil {
+			return err
+		}
+		if endp.Metadata.GetName() != k.serviceName {
+			continue
+		}
+		switch event.GetType() {
+		case k8s.EventAdded, k8s.EventModified:
+			k.addServiceAnnotations(endp, services)
+			endpoints[objectKey(endp.Metadata)] = endp
+		case k8s.EventDeleted:
+			delete(endpoints, objectKey(endp.Metadata))
+			delete(services, objectKey(endp.Metadata))
+		default:
+			return fmt.Errorf("Received %s event from endpoints watch", event.GetType())
+		}
+		k.update(namespace, k.endpointsTargets(endpoints))
+	}
+}
+
+// listPods lists the pods in the namespace matching the label selector; requirements which cannot
+// be expressed through the client are applied to the results
+func (k *kubeLocator) listPods(namespace string) (map[string]*apiv1.Pod, string, error) {
+	list, err := k.client.CoreV1().ListPods(context.Background(), namespace, k.selector.option())
+	if err != nil {
+		return nil, "", err
+	}
+	pods := make(map[string]*apiv1.Pod, len(list.Items))
+	for _, pod := range list.Items {
+		if k.selector.matches(pod.Metadata.GetLabels()) {
+			pods[objectKey(pod.Metadata)] = pod
+		}
+	}
+	return pods, list.Metadata.GetResourceVersion(), nil
+}
+
+func (k *kubeLocator) listAndWatchPods(namespace string) error {
+	pods, resourceVersion, err := k.listPods(namespace)
+	if err != nil {
+		return err
+	}
+	k.update(namespace, k.podTargets(pods))
+
+	watcher, err := k.client.CoreV1().WatchPods(context.Background(), namespace,
+		k.selector.option(), k8s.ResourceVersion(resourceVersion))
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	for {
+		event, pod, err := watcher.Next()
+		if err != nil {
+			return err
+		}
+		switch event.GetType() {
+		case k8s.EventAdded, k8s.EventModified:
+			if k.selector.matches(pod.Metadata.GetLabels()) {
+				pods[objectKey(pod.Metadata)] = pod
+			} else {
+				// the pod's labels changed such that it no longer matches
+				delete(pods, objectKey(pod.Metadata))
+			}
+		case k8s.EventDeleted:
+			delete(pods, objectKey(pod.Metadata))
+		default:
+			return fmt.Errorf("Received %s event from pods watch", event.GetType())
+		}
+		k.update(namespace, k.podTargets(pods))
+	}
+}
+
+// update replaces the cached targets for the namespace, signaling a change if they differ
+// from the previous targets
+func (k *kubeLocator) update(namespace string, targets []*locator.Target) {
+	k.mutex.Lock()
+	previous, synced := k.targets[namespace]
+	changed := !synced || !reflect.DeepEqual(targets, previous)
+	k.targets[namespace] = targets
+	k.mutex.Unlock()
+
+	if changed {
+		if log.GetLevel() >= log.DebugLevel {
+			log.Debugf("Targets for %v in namespace %s changed: %v", k, namespaceName(namespace), targets)
+		}
+		select {
+		case k.changes <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func sortedKeys(endpoints map[string]*apiv1.Endpoints) []string {
+	keys := make([]string, 0, len(endpoints))
+	for key := range endpoints {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedPodKeys(pods map[string]*apiv1.Pod) []string {
+	keys := make([]string, 0, len(pods))
+	for key := range pods {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,182 @@
+package kuberneteslocator
+
+import (
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ericchiang/k8s"
+	apiv1 "github.com/ericchiang/k8s/api/v1"
+	metav1 "github.com/ericchiang/k8s/apis/meta/v1"
+	"github.com/ericchiang/k8s/runtime"
+	"github.com/ericchiang/k8s/watch/versioned"
+	"github.com/golang/protobuf/proto"
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/stretchr/testify/assert"
+)
+
+// magicBytes prefix kubernetes protobuf objects
+var magicBytes = []byte{0x6b, 0x38, 0x73, 0x00}
+
+func encode(t *testing.T, obj proto.Message) []byte {
+	raw, err := proto.Marshal(obj)
+	assert.Nil(t, err)
+	unknown, err := (&runtime.Unknown{Raw: raw}).Marshal()
+	assert.Nil(t, err)
+	return append(append([]byte{}, magicBytes...), unknown...)
+}
+
+// fakeAPIServer serves the endpoints and service of a single namespace; each watch streams the
+// endpoints sent to its events channel, and is closed when a nil value is sent
+type fakeAPIServer struct {
+	t         *testing.T
+	mutex     sync.Mutex
+	endpoints *apiv1.Endpoints
+	lists     int
+	gets      int
+	events    chan *apiv1.Endpoints
+	done      chan struct{}
+}
+
+func (f *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/v1/namespaces/monitoring/services/prometheus":
+		f.mutex.Lock()
+		f.gets++
+		f.mutex.Unlock()
+		w.Write(encode(f.t, &apiv1.Service{Metadata: &metav1.ObjectMeta{
+			Name:        s("prometheus"),
+			Namespace:   s("monitoring"),
+			Annotations: map[string]string{"mpp.io/weight": "2"},
+		}}))
+	case "/api/v1/namespaces/monitoring/endpoints":
+		if r.URL.Query().Get("watch") != "true" {
+			f.mutex.Lock()
+			f.lists++
+			list := &apiv1.EndpointsList{
+				Metadata: &metav1.ListMeta{ResourceVersion: s("1")},
+				Items:    []*apiv1.Endpoints{f.endpoints},
+			}
+			f.mutex.Unlock()
+			w.Write(encode(f.t, list))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case <-f.done:
+				return
+			case endp := <-f.events:
+				if endp == nil {
+					return
+				}
+				f.mutex.Lock()
+				f.endpoints = endp
+				f.mutex.Unlock()
+				event, err := proto.Marshal(&versioned.Event{
+					Type:   s(k8s.EventModified),
+					Object: &runtime.RawExtension{Raw: encode(f.t, endp)},
+				})
+				assert.Nil(f.t, err)
+				length := make([]byte, 4)
+				binary.BigEndian.PutUint32(length, uint32(len(event)))
+				w.Write(append(length, event...))
+				w.(http.Flusher).Flush()
+			}
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeAPIServer) counts() (int, int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.lists, f.gets
+}
+
+func endpoints(ips ...string) *apiv1.Endpoints {
+	var addresses []*apiv1.EndpointAddress
+	for _, ip := range ips {
+		addresses = append(addresses, &apiv1.EndpointAddress{Ip: s(ip)})
+	}
+	return &apiv1.Endpoints{
+		Metadata: &metav1.ObjectMeta{Name: s("prometheus"), Namespace: s("monitoring")},
+		Subsets: []*apiv1.EndpointSubset{{
+			NotReadyAddresses: addresses,
+			Ports:             []*apiv1.EndpointPort{{Name: s("web"), Port: i32(9090), Protocol: s("TCP")}},
+		}},
+	}
+}
+
+func TestWatchEndpoints(t *testing.T) {
+	// not restored, as the watch outlives the test
+	watchRetryDelay = 10 * time.Millisecond
+
+	api := &fakeAPIServer{
+		t:         t,
+		endpoints: endpoints("10.0.0.1"),
+		events:    make(chan *apiv1.Endpoints),
+		done:      make(chan struct{}),
+	}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	defer close(api.done)
+
+	k := &kubeLocator{
+		client:      &k8s.Client{Endpoint: server.URL, Client: http.DefaultClient},
+		portName:    "web",
+		namespaces:  []string{"monitoring"},
+		serviceName: "prometheus",
+		targets:     make(map[string][]*locator.Target),
+		changes:     make(chan struct{}, 1),
+	}
+
+	// the endpoints are polled until the watch has synced
+	found, err := k.Endpoints()
+	assert.Nil(t, err)
+	assert.Len(t, found, 1)
+	assert.Equal(t, "http://10.0.0.1:9090", found[0].Address)
+	assert.Equal(t, map[string]string{"weight": "2"}, found[0].Labels)
+
+	targets := func() map[string]string {
+		select {
+		case <-k.changes:
+		case <-time.After(5 * time.Second):
+			assert.Fail(t, "Timed out waiting for a change")
+		}
+		k.mutex.RLock()
+		defer k.mutex.RUnlock()
+		for _, target := range k.targets["monitoring"] {
+			assert.Equal(t, map[string]string{"weight": "2"}, target.Labels)
+		}
+		return summarize(k.targets["monitoring"])
+	}
+
+	go k.watch("monitoring")
+	assert.Equal(t, map[string]string{"http://10.0.0.1:9090": "endpoint address is not ready"}, targets())
+
+	// watch events are applied without fetching the service again
+	api.events <- endpoints("10.0.0.1", "10.0.0.2")
+	assert.Equal(t, map[string]string{
+		"http://10.0.0.1:9090": "endpoint address is not ready",
+		"http://10.0.0.2:9090": "endpoint address is not ready",
+	}, targets())
+	lists, gets := api.counts()
+	assert.Equal(t, 2, lists)
+	assert.Equal(t, 2, gets)
+
+	// a closed watch is followed by a re-list, which fetches the service again
+	api.mutex.Lock()
+	api.endpoints = endpoints("10.0.0.3")
+	api.mutex.Unlock()
+	api.events <- nil
+	assert.Equal(t, map[string]string{"http://10.0.0.3:9090": "endpoint address is not ready"}, targets())
+	lists, gets = api.counts()
+	assert.Equal(t, 3, lists)
+	assert.Equal(t, 3, gets)
+}
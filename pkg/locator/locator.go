@@ -1,24 +1,19 @@
 package locator
 
 import (
-	"bufio"
 	"context"
+	"crypto/tls"
 	"fmt"
-	"io/ioutil"
-	"math/big"
 	"net"
 	"net/http"
-	"regexp"
-	"strings"
+	"net/url"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/prometheus/client_golang/api/prometheus"
-)
-
-var (
-	splitter = regexp.MustCompile("\r?\n")
+	"github.com/prometheus/common/model"
 )
 
 // Locator is a pluggable interface for locating prometheus endpoints
@@ -28,6 +23,14 @@ type Locator interface {
 	Endpoints() ([]*PrometheusEndpoint, error)
 }
 
+// ChangeNotifier is an optional interface for locators which are able to detect
+// changes to their candidate endpoints as they happen, rather than only when polled
+type ChangeNotifier interface {
+
+	// Changes provides a channel which receives a value whenever the candidate endpoints change
+	Changes() <-chan struct{}
+}
+
 // PrometheusEndpoint encapsulates a QueryAPI instance and its associated address
 type PrometheusEndpoint struct {
 	QueryAPI              prometheus.QueryAPI
@@ -35,156 +38,115 @@ type PrometheusEndpoint struct {
 	Uptime                time.Duration
 	Selected              bool
 	Address               string
+	Labels                map[string]string
+	NotReadyReason        string
 	ComparisonMetricValue interface{}
+	// ComparisonMetricName optionally describes the metric used to compute ComparisonMetricValue
+	// for this endpoint, when it differs between endpoints
+	ComparisonMetricName string
+	// EliminatedBy names the stage of a composite strategy which excluded this endpoint, and
+	// EliminatedAt is that stage's (1-based) position, distinguishing repeated strategies
+	EliminatedBy string
+	EliminatedAt int
+	// results of probing the endpoint, cached for the selection round
+	mutex     sync.Mutex
+	scraped   bool
+	samples   model.Vector
+	scrapeErr error
+	upChecked bool
+	upErr     error
+}
+
+// Target describes a candidate prometheus endpoint prior to probing, along with
+// any labels attached to it by the locator which discovered it
+type Target struct {
+	Address string
+	Labels  map[string]string
+	// NotReadyReason is set when the locator has determined that the target is not
+	// ready to receive traffic; such targets are reported, but not probed
+	NotReadyReason string
+}
+
+func (t *Target) String() string {
+	return t.Address
 }
 
 func (pe *PrometheusEndpoint) String() string {
 	return pe.Address
 }
 
+// BackendKey returns the name of the backend represented by the provided target, which
+// identifies it in the router's and strategies' state and metrics
+func BackendKey(target *url.URL) string {
+	return fmt.Sprintf("%s://%s%s", target.Scheme, target.Host, target.Path)
+}
+
+// Ready returns false if the endpoint was reported as not ready by its locator
+func (pe *PrometheusEndpoint) Ready() bool {
+	return len(pe.NotReadyReason) == 0
+}
+
 const connectionTimetout = 1 * time.Second
 const readTimeout = 3 * time.Second
 
-func timeoutDialer(netw, addr string) (net.Conn, error) {
-	conn, err := net.DialTimeout(netw, addr, connectionTimetout)
-	if err != nil {
-		return nil, err
-	}
-	conn.SetDeadline(time.Now().Add(readTimeout))
-	return conn, nil
-}
+// tlsConfig is used for all connections to prometheus endpoints
+var tlsConfig = &tls.Config{}
 
 var httpClient = &http.Client{
 	Transport: &http.Transport{
-		Dial: timeoutDialer,
+		DialContext:           (&net.Dialer{Timeout: connectionTimetout}).DialContext,
+		ResponseHeaderTimeout: readTimeout,
+		TLSClientConfig:       tlsConfig,
 	},
 }
 
-// Viable returns true if the endpoint is able to
-// respond to basic query API requests within a reasonable time
-func (pe *PrometheusEndpoint) Viable() bool {
-	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
-	_, err := pe.QueryAPI.Query(ctx, "up", time.Now())
-	defer cancel()
-	if err != nil {
-		log.Warnf("Endpoint %v is not viable, based on returned error: %v", pe, err)
-		return false
-	}
-	return true
+// queryTransport is used by the query API clients of prometheus endpoints; it matches the
+// client library's default transport, other than its TLS config
+var queryTransport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	TLSHandshakeTimeout: 10 * time.Second,
+	TLSClientConfig:     tlsConfig,
 }
 
-type staticLocator struct {
-	endpointsFile string
+// SetInsecureCerts sets whether connections to https prometheus endpoints with unverifiable
+// certs are allowed; it must be called before any endpoints are located
+func SetInsecureCerts(insecure bool) {
+	tlsConfig.InsecureSkipVerify = insecure
 }
 
-// NewEndpointsFileLocator returns a new Locator which reads
-// a set of endpoints from a file path, one endpoint per line
-func NewEndpointsFileLocator(endpointsFile string) Locator {
-	return &staticLocator{endpointsFile: endpointsFile}
-}
+// Viable returns true if the endpoint is able to respond to basic query API requests
+// within a reasonable time; the result is determined at most once per endpoint (i.e.,
+// once per selection round), normally while the endpoint is probed
+func (pe *PrometheusEndpoint) Viable() bool {
+	pe.mutex.Lock()
+	if !pe.upChecked && pe.QueryAPI != nil {
+		ctx, cancel := context.WithTimeout(context.TODO(), upTimeout)
+		_, pe.upErr = pe.QueryAPI.Query(ctx, "up", time.Now())
+		cancel()
+		pe.upChecked = true
+	}
+	err := pe.upErr
+	pe.mutex.Unlock()
 
-// Endpoints provides a list of candidate prometheus endpoints
-func (sl *staticLocator) Endpoints() ([]*PrometheusEndpoint, error) {
-	b, err := ioutil.ReadFile(sl.endpointsFile)
+	if pe.QueryAPI == nil {
+		return false
+	}
 	if err != nil {
-		return nil, err
+		log.Warnf("Endpoint %v is not viable, based on returned error: %v", pe, err)
+		return false
 	}
-	return ToPrometheusClients(splitter.Split(strings.Trim(string(b), "\n"), -1))
+	return true
 }
 
 // ToPrometheusClients generates prometheus Client objects from a provided list of URLs
 func ToPrometheusClients(endpointURLs []string) ([]*PrometheusEndpoint, error) {
-	endpoints := make([]*PrometheusEndpoint, 0, len(endpointURLs))
+	targets := make([]*Target, 0, len(endpointURLs))
 	for _, endpoint := range endpointURLs {
-		addr := strings.Trim(endpoint, " ")
-		if len(addr) > 0 {
-			var uptime time.Duration
-			var queryAPI prometheus.QueryAPI
-			client, err := prometheus.New(prometheus.Config{
-				Address: addr,
-			})
-			if err == nil {
-				// Scape the /metrics endpoint of the individual prometheus instance, since
-				// self-scaping of prometheus' own metrics might not be configured
-				if log.GetLevel() >= log.DebugLevel {
-					log.Debugf("Testing %s/metrics", addr)
-				}
-				scraped, err := ScrapeMetric(addr, "process_start_time_seconds")
-				if err == nil && scraped != nil {
-					processStartTimeSeconds := scraped.Value
-					uptime = time.Duration(time.Now().UTC().Unix()-int64(processStartTimeSeconds)) * time.Second
-					if log.GetLevel() >= log.DebugLevel {
-						log.Debugf("Parsed current uptime for %s: %s", addr, uptime)
-					}
-					queryAPI = prometheus.NewQueryAPI(client)
-					_, err = queryAPI.Query(context.TODO(), "up", time.Now())
-					if err != nil && log.GetLevel() >= log.DebugLevel {
-						log.Debugf("Query 'up' returned error: %v", err)
-					}
-				}
-			}
-
-			if err == nil {
-				endpoints = append(endpoints, &PrometheusEndpoint{QueryAPI: queryAPI, Address: addr, Uptime: uptime})
-			} else {
-				log.Errorf("Failed to resolve build_info and uptime for %v: %v", addr, err)
-				endpoints = append(endpoints, &PrometheusEndpoint{Address: addr, Uptime: time.Duration(0), Error: err})
-			}
-		}
-	}
-	if len(endpoints) == 0 {
-		return nil, fmt.Errorf("Unable to locate any potential endpoints")
-	}
-	return endpoints, nil
-}
-
-// LabeledValue represents a persed metric instance
-type LabeledValue struct {
-	Name   string
-	Labels string
-	Value  float64
-}
-
-func (lv *LabeledValue) String() string {
-	return fmt.Sprintf("%s%s %f", lv.Name, lv.Labels, lv.Value)
-}
-
-// ScrapeMetric parses metrics in a simple fashion, returning
-// the first instance of each metric for a given name; results may be unexpected
-// for metrics with multiple instances
-func ScrapeMetric(addr string, name string) (*LabeledValue, error) {
-
-	resp, err := httpClient.Get(fmt.Sprintf("%s/metrics", addr))
-	if err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%s/metrics returned %d", addr, resp.StatusCode)
-	}
-
-	defer resp.Body.Close()
-	scanner := bufio.NewScanner(resp.Body)
-	scanner.Split(bufio.ScanLines)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if !strings.HasPrefix(line, "#") {
-			parts := strings.Split(line, " ")
-			nameParts := strings.Split(parts[0], "{")
-			if nameParts[0] == name {
-				f := new(big.Float)
-				_, err := fmt.Sscan(parts[1], f)
-				if err == nil {
-					v := &LabeledValue{Name: nameParts[0]}
-					v.Value, _ = f.Float64()
-					if len(nameParts) > 1 {
-						v.Labels = "{" + nameParts[1]
-					}
-					return v, nil
-				}
-				return nil, fmt.Errorf("Failed to parse value for metric %s", line)
-			}
-		}
+		targets = append(targets, &Target{Address: endpoint})
 	}
-	return nil, nil
+	return ProbeTargets(targets)
 }
@@ -0,0 +1,157 @@
+package marathonlocator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/matt-deboer/go-marathon"
+	"github.com/matt-deboer/mpp/pkg/locator"
+	log "github.com/sirupsen/logrus"
+)
+
+// weightLabel is the marathon app label specifying the relative weight of the app's tasks,
+// used by weighted strategies
+const weightLabel = "mpp.io/weight"
+
+// appSpec describes a configured marathon app, or group of apps, and the port
+// of its tasks on which prometheus is listening; specs take the form
+// '{appID}[:{portName|portIndex}]', where the app ID may be a group wildcard such as '/monitoring/*'
+type appSpec struct {
+	spec string
+	// id is the normalized app ID; for wildcards, it is the prefix which matching app IDs share
+	id        string
+	wildcard  bool
+	portName  string
+	portIndex int
+}
+
+func (a *appSpec) String() string {
+	return a.spec
+}
+
+func parseAppSpec(spec string) (*appSpec, error) {
+	a := &appSpec{spec: strings.TrimSpace(spec)}
+	parts := strings.SplitN(a.spec, ":", 2)
+	id := strings.TrimSpace(parts[0])
+	if len(parts) == 2 {
+		port := strings.TrimSpace(parts[1])
+		if len(port) == 0 {
+			return nil, fmt.Errorf("Invalid marathon app '%s': port name or index is empty", spec)
+		}
+		if index, err := strconv.Atoi(port); err == nil {
+			if index < 0 {
+				return nil, fmt.Errorf("Invalid marathon app '%s': port index must not be negative", spec)
+			}
+			a.portIndex = index
+		} else {
+			a.portName = port
+		}
+	}
+
+	if strings.HasSuffix(id, "*") {
+		a.wildcard = true
+		id = strings.TrimSuffix(id, "*")
+		if len(strings.Trim(id, "/")) == 0 {
+			a.id = "/"
+		} else if !strings.HasSuffix(id, "/") {
+			return nil, fmt.Errorf("Invalid marathon app '%s': wildcards must match an entire group, e.g. '/monitoring/*'", spec)
+		} else {
+			a.id = normalizeAppID(id) + "/"
+		}
+	} else {
+		if len(strings.Trim(id, "/")) == 0 {
+			return nil, fmt.Errorf("Invalid marathon app '%s': app ID is empty", spec)
+		}
+		a.id = normalizeAppID(id)
+	}
+	if strings.Contains(a.id, "*") {
+		return nil, fmt.Errorf("Invalid marathon app '%s': wildcards are only supported as the final path element", spec)
+	}
+	return a, nil
+}
+
+// matches returns true if the app ID is selected by this spec
+func (a *appSpec) matches(appID string) bool {
+	appID = normalizeAppID(appID)
+	if a.wildcard {
+		return strings.HasPrefix(appID, a.id)
+	}
+	return appID == a.id
+}
+
+// port returns the port of the task on which prometheus is listening, resolving port names
+// through the app's port definitions (or docker port mappings)
+func (a *appSpec) port(app *marathon.Application, task *marathon.Task) (int, error) {
+	index := a.portIndex
+	if len(a.portName) > 0 {
+		var found bool
+		if index, found = portIndex(app, a.portName); !found {
+			return 0, fmt.Errorf("app %s has no port named '%s'", app.ID, a.portName)
+		}
+	}
+	if index >= len(task.Ports) {
+		return 0, fmt.Errorf("task %s has no port at index %d", task.ID, index)
+	}
+	return task.Ports[index], nil
+}
+
+func portIndex(app *marathon.Application, name string) (int, bool) {
+	if app.PortDefinitions != nil {
+		for i, pd := range *app.PortDefinitions {
+			if pd.Name == name {
+				return i, true
+			}
+		}
+	}
+	if app.Container != nil && app.Container.Docker != nil && app.Container.Docker.PortMappings != nil {
+		for i, pm := range *app.Container.Docker.PortMappings {
+			if pm.Name == name {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// taskNotReadyReason returns a description of why the task is not ready, or the
+// empty string if the task is running and passing all of the app's health checks
+func taskNotReadyReason(app *marathon.Application, task *marathon.Task) string {
+	if len(task.State) > 0 && task.State != "TASK_RUNNING" {
+		return fmt.Sprintf("task is %s", strings.ToLower(strings.TrimPrefix(task.State, "TASK_")))
+	}
+	if app.HealthChecks == nil || len(*app.HealthChecks) == 0 {
+		return ""
+	}
+	if len(task.HealthCheckResults) == 0 {
+		return "task has no health check results"
+	}
+	for _, result := range task.HealthCheckResults {
+		if result == nil || !result.Alive {
+			return "task is failing health checks"
+		}
+	}
+	return ""
+}
+
+// appLabels returns the labels attached to targets for the tasks of the app
+func appLabels(app *marathon.Application) map[string]string {
+	labels := map[string]string{"app": app.ID}
+	if app.Labels == nil {
+		return labels
+	}
+	if weight, ok := (*app.Labels)[weightLabel]; ok {
+		weight = strings.TrimSpace(weight)
+		if value, err := strconv.ParseFloat(weight, 64); err == nil && value >= 0 {
+			labels[locator.WeightLabel] = weight
+		} else {
+			log.Warnf("Ignoring invalid value for label %s of marathon application '%s': '%s'", weightLabel, app.ID, weight)
+		}
+	}
+	return labels
+}
+
+// normalizeAppID returns the app ID in its absolute form, e.g. '/monitoring/prometheus'
+func normalizeAppID(appID string) string {
+	return "/" + strings.Trim(strings.TrimSpace(appID), "/")
+}
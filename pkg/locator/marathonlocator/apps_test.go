@@ -0,0 +1,99 @@
+package marathonlocator
+
+import (
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAppSpec(t *testing.T) {
+	spec, err := parseAppSpec("monitoring/prometheus")
+	assert.Nil(t, err)
+	assert.Equal(t, "/monitoring/prometheus", spec.id)
+	assert.Equal(t, 0, spec.portIndex)
+	assert.True(t, spec.matches("/monitoring/prometheus"))
+	assert.False(t, spec.matches("/monitoring/prometheus-2"))
+
+	spec, err = parseAppSpec("/monitoring/prometheus:web")
+	assert.Nil(t, err)
+	assert.Equal(t, "web", spec.portName)
+
+	spec, err = parseAppSpec("/monitoring/*:1")
+	assert.Nil(t, err)
+	assert.True(t, spec.wildcard)
+	assert.Equal(t, 1, spec.portIndex)
+	assert.True(t, spec.matches("/monitoring/prometheus"))
+	assert.True(t, spec.matches("/monitoring/dc1/prometheus"))
+	assert.False(t, spec.matches("/monitoring-other/prometheus"))
+
+	spec, err = parseAppSpec("*")
+	assert.Nil(t, err)
+	assert.True(t, spec.matches("/anything"))
+
+	for _, invalid := range []string{"", "/monitoring/prom*", "/monitoring/prometheus:", "/monitoring/prometheus:-1", "/*/prometheus"} {
+		_, err = parseAppSpec(invalid)
+		assert.NotNil(t, err, "expected an error for '%s'", invalid)
+	}
+}
+
+// sortTargets orders targets by address, as the apps are served in no particular order
+func sortTargets(targets []*locator.Target) {
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Address < targets[j].Address })
+}
+
+func TestTargets(t *testing.T) {
+	fake := newFakeMarathon()
+	fake.apps["/monitoring/prometheus"] = `{
+		"id": "/monitoring/prometheus",
+		"portDefinitions": [{"port": 0, "name": "sidecar"}, {"port": 0, "name": "web"}],
+		"healthChecks": [{"protocol": "HTTP", "path": "/-/healthy"}],
+		"tasks": [
+			{"id": "p1", "host": "10.0.0.1", "ports": [31000, 31001], "state": "TASK_RUNNING",
+				"healthCheckResults": [{"alive": true}]},
+			{"id": "p2", "host": "10.0.0.2", "ports": [31000, 31001], "state": "TASK_RUNNING",
+				"healthCheckResults": [{"alive": false}]},
+			{"id": "p3", "host": "10.0.0.3", "ports": [31000, 31001], "state": "TASK_STAGING"},
+			{"id": "p4", "host": "10.0.0.4", "ports": [31000, 31001], "state": "TASK_RUNNING"}
+		]}`
+	fake.apps["/monitoring/dc2/prometheus"] = `{
+		"id": "/monitoring/dc2/prometheus",
+		"labels": {"mpp.io/weight": "2"},
+		"container": {"docker": {"portMappings": [{"containerPort": 9090, "hostPort": 0, "name": "web"}]}},
+		"tasks": [{"id": "d1", "host": "10.0.1.1", "ports": [32000], "state": "TASK_RUNNING"}]}`
+	fake.apps["/other/prometheus"] = `{
+		"id": "/other/prometheus",
+		"tasks": [{"id": "o1", "host": "10.0.2.1", "ports": [33000], "state": "TASK_RUNNING"}]}`
+
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	defer close(fake.done)
+
+	ml, err := NewMarathonLocator(server.URL, []string{"/monitoring/prometheus:web"}, "", "", false)
+	assert.Nil(t, err)
+	targets, err := ml.(*marathonLocator).targets()
+	assert.Nil(t, err)
+	sortTargets(targets)
+	// each task is a target, labelled by its app, and reported as not ready unless healthy
+	labels := map[string]string{"app": "/monitoring/prometheus"}
+	tasks := []*locator.Target{
+		{Address: "http://10.0.0.1:31001", Labels: labels},
+		{Address: "http://10.0.0.2:31001", Labels: labels, NotReadyReason: "task is failing health checks"},
+		{Address: "http://10.0.0.3:31001", Labels: labels, NotReadyReason: "task is staging"},
+		{Address: "http://10.0.0.4:31001", Labels: labels, NotReadyReason: "task has no health check results"},
+	}
+	assert.Equal(t, tasks, targets)
+
+	ml, err = NewMarathonLocator(server.URL, []string{"/monitoring/*:web"}, "", "", false)
+	assert.Nil(t, err)
+	targets, err = ml.(*marathonLocator).targets()
+	assert.Nil(t, err)
+	sortTargets(targets)
+	// matching apps without health checks have ready tasks, and app weights are labels
+	assert.Equal(t, append(tasks, &locator.Target{
+		Address: "http://10.0.1.1:32000",
+		Labels:  map[string]string{"app": "/monitoring/dc2/prometheus", "weight": "2"},
+	}), targets)
+}
@@ -0,0 +1,112 @@
+package marathonlocator
+
+import (
+	"github.com/matt-deboer/go-marathon"
+	log "github.com/sirupsen/logrus"
+)
+
+// eventsFilter selects the marathon events which may affect the tasks of the configured apps
+const eventsFilter = marathon.EventIDStatusUpdate |
+	marathon.EventIDChangedHealthCheck |
+	marathon.EventIDFailedHealthCheck |
+	marathon.EventIDAppTerminated |
+	marathon.EventIDDeploymentSuccess |
+	marathon.EventIDDeploymentFailed |
+	marathon.EventIDDeploymentInfo |
+	marathon.EventIDDeploymentStepSuccess |
+	marathon.EventIDDeploymentStepFailed
+
+// Changes provides a channel which receives a value whenever an event affecting
+// the configured apps is received from marathon
+func (ml *marathonLocator) Changes() <-chan struct{} {
+	return ml.changes
+}
+
+// subscribe registers a listener on marathon's event stream; if the stream cannot be
+// established, or is later interrupted, endpoints are still found by polling on each interval;
+// the mutex must be held
+func (ml *marathonLocator) subscribe() {
+	events, err := ml.client.AddEventsListener(eventsFilter)
+	if err != nil {
+		log.Warnf("Failed to subscribe to marathon events for %v; falling back to polling: %v", ml, err)
+		return
+	}
+	ml.events = events
+	go ml.handleEvents(events)
+}
+
+// unsubscribe removes the listener from marathon's event stream; the mutex must be held
+func (ml *marathonLocator) unsubscribe() {
+	if ml.events != nil {
+		ml.client.RemoveEventsListener(ml.events)
+		ml.events = nil
+	}
+}
+
+func (ml *marathonLocator) handleEvents(events marathon.EventsChannel) {
+	for event := range events {
+		if !ml.affectedBy(event) {
+			continue
+		}
+		if log.GetLevel() >= log.DebugLevel {
+			log.Debugf("Received marathon event for %v: %s", ml, event.Name)
+		}
+		select {
+		case ml.changes <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// affectedBy returns true if the event concerns one of the configured apps
+func (ml *marathonLocator) affectedBy(event *marathon.Event) bool {
+	switch e := event.Event.(type) {
+	case *marathon.EventStatusUpdate:
+		return ml.includesApp(e.AppID)
+	case *marathon.EventHealthCheckChanged:
+		return ml.includesApp(e.AppID)
+	case *marathon.EventFailedHealthCheck:
+		return ml.includesApp(e.AppID)
+	case *marathon.EventAppTerminated:
+		return ml.includesApp(e.AppID)
+	case *marathon.EventDeploymentSuccess:
+		return ml.planAffected(e.Plan)
+	case *marathon.EventDeploymentInfo:
+		return ml.planAffected(e.Plan)
+	case *marathon.EventDeploymentStepSuccess:
+		return ml.planAffected(e.Plan)
+	case *marathon.EventDeploymentStepFailure:
+		return ml.planAffected(e.Plan)
+	case *marathon.EventDeploymentFailed:
+		// the failure event does not describe the deployment plan
+		return true
+	}
+	return false
+}
+
+func (ml *marathonLocator) planAffected(plan *marathon.DeploymentPlan) bool {
+	if plan == nil {
+		return true
+	}
+	for _, step := range plan.Steps {
+		if step == nil {
+			continue
+		}
+		for _, action := range step.Actions {
+			if ml.includesApp(action.App) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// includesApp returns true if the app ID is selected by one of the configured apps
+func (ml *marathonLocator) includesApp(appID string) bool {
+	for _, app := range ml.apps {
+		if app.matches(appID) {
+			return true
+		}
+	}
+	return false
+}
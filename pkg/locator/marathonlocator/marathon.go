@@ -2,6 +2,8 @@ package marathonlocator
 
 import (
 	"fmt"
+	"net/url"
+	"sync"
 
 	log "github.com/sirupsen/logrus"
 
@@ -10,27 +12,38 @@ import (
 )
 
 type marathonLocator struct {
-	client        marathon.Marathon
+	url           string
 	authEndpoint  string
-	apps          []string
+	apps          []*appSpec
 	authenticator *authenticator
+	changes       chan struct{}
+	// mutex guards the client and its event stream, which are replaced when re-authenticating
+	mutex  sync.Mutex
+	client marathon.Marathon
+	events marathon.EventsChannel
 }
 
 func (ml *marathonLocator) String() string {
-	return fmt.Sprintf("%T{url: %s, apps: %v}", ml, ml.client.GetMarathonURL(), ml.apps)
+	return fmt.Sprintf("%T{url: %s, apps: %v}", ml, ml.url, ml.apps)
 }
 
 // NewMarathonLocator generates a new marathon prometheus locator
 func NewMarathonLocator(marathonAPI string, prometheusApps []string, authEndpoint, principalSecret string, insecure bool) (locator.Locator, error) {
 
 	ml := &marathonLocator{
+		url:          marathonAPI,
 		authEndpoint: authEndpoint,
-		apps:         prometheusApps,
+		changes:      make(chan struct{}, 1),
+	}
+	for _, app := range prometheusApps {
+		spec, err := parseAppSpec(app)
+		if err != nil {
+			return nil, err
+		}
+		ml.apps = append(ml.apps, spec)
 	}
 	var client marathon.Marathon
 	var err error
-	config := marathon.NewDefaultConfig()
-	config.URL = marathonAPI
 	if len(principalSecret) > 0 {
 		var authContext *authContext
 		authContext, err = fromPrincipalSecret([]byte(principalSecret))
@@ -44,7 +57,7 @@ func NewMarathonLocator(marathonAPI string, prometheusApps []string, authEndpoin
 		ml.authenticator = authenticator
 		client, err = ml.authenticate(marathonAPI)
 	} else {
-		client, err = marathon.NewClient(config)
+		client, err = marathon.NewClient(newConfig(marathonAPI))
 	}
 	if err != nil {
 		return nil, fmt.Errorf("Failed to construct marathon client: %v", err)
@@ -53,13 +66,37 @@ func NewMarathonLocator(marathonAPI string, prometheusApps []string, authEndpoin
 	if ok, err := client.Ping(); !ok {
 		return nil, err
 	}
-	ml.client = client
+	ml.useClient(client)
 	return ml, nil
 }
 
-func (ml *marathonLocator) authenticate(marathonURL string) (marathon.Marathon, error) {
+// useClient replaces the client, re-establishing the event stream with the new client
+func (ml *marathonLocator) useClient(client marathon.Marathon) {
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+	ml.unsubscribe()
+	ml.client = client
+	ml.subscribe()
+}
+
+// marathonClient returns the current client
+func (ml *marathonLocator) marathonClient() marathon.Marathon {
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+	return ml.client
+}
+
+// newConfig returns the client configuration for the provided marathon URL; events
+// are received over marathon's event stream (SSE), as no callback endpoint is exposed
+func newConfig(marathonURL string) marathon.Config {
 	config := marathon.NewDefaultConfig()
 	config.URL = marathonURL
+	config.EventsTransport = marathon.EventsTransportSSE
+	return config
+}
+
+func (ml *marathonLocator) authenticate(marathonURL string) (marathon.Marathon, error) {
+	config := newConfig(marathonURL)
 	token, err := ml.authenticator.authenticate()
 	if err != nil {
 		return nil, err
@@ -73,30 +110,79 @@ func (ml *marathonLocator) authenticate(marathonURL string) (marathon.Marathon,
 
 // Endpoints provides a list of candidate prometheus endpoints
 func (ml *marathonLocator) Endpoints() ([]*locator.PrometheusEndpoint, error) {
+	targets, err := ml.targets()
+	if err != nil {
+		return nil, err
+	}
+	return locator.ProbeTargets(targets)
+}
 
-	endpoints := []string{}
-	for _, name := range ml.apps {
-		app, err := ml.client.ApplicationBy(name, nil)
+// targets builds the list of targets from the tasks of the configured apps; tasks which are
+// not running, or are failing their health checks, are included as not-ready targets
+func (ml *marathonLocator) targets() ([]*locator.Target, error) {
+	targets := []*locator.Target{}
+	for _, spec := range ml.apps {
+		apps, err := ml.applications(spec)
 		if apiError, ok := err.(*marathon.APIError); ok && apiError.ErrCode == marathon.ErrCodeUnauthorized {
-			client, err := ml.authenticate(ml.client.GetMarathonURL())
-			if err != nil {
-				return nil, err
+			client, authErr := ml.authenticate(ml.url)
+			if authErr != nil {
+				return nil, authErr
 			}
-			ml.client = client
-			app, err = ml.client.ApplicationBy(name, nil)
+			// the event stream was established using the expired token
+			ml.useClient(client)
+			apps, err = ml.applications(spec)
 		}
 
 		if err != nil {
 			if apiError, ok := err.(*marathon.APIError); ok {
-				log.Errorf("Failed to resolve marathon application '%s': %d, %v", name, apiError.ErrCode, err)
+				log.Errorf("Failed to resolve marathon application '%v': %d, %v", spec, apiError.ErrCode, err)
 			} else {
-				log.Errorf("Failed to resolve marathon application '%s': %v", name, err)
+				log.Errorf("Failed to resolve marathon application '%v': %v", spec, err)
 			}
-		} else {
+			continue
+		}
+		for _, app := range apps {
 			for _, task := range app.Tasks {
-				endpoints = append(endpoints, fmt.Sprintf("http://%s:%d", task.Host, task.Ports[0]))
+				port, err := spec.port(app, task)
+				if err != nil {
+					log.Warnf("Skipping task of marathon application '%s': %v", app.ID, err)
+					continue
+				}
+				targets = append(targets, &locator.Target{
+					Address:        fmt.Sprintf("http://%s:%d", task.Host, port),
+					Labels:         appLabels(app),
+					NotReadyReason: taskNotReadyReason(app, task),
+				})
 			}
 		}
 	}
-	return locator.ToPrometheusClients(endpoints)
+	return targets, nil
+}
+
+// applications returns the apps, including their tasks, which are selected by the spec
+func (ml *marathonLocator) applications(spec *appSpec) ([]*marathon.Application, error) {
+	client := ml.marathonClient()
+	if !spec.wildcard {
+		app, err := client.ApplicationBy(spec.id, nil)
+		if err != nil {
+			return nil, err
+		}
+		return []*marathon.Application{app}, nil
+	}
+	params := url.Values{"embed": []string{"apps.tasks"}}
+	if spec.id != "/" {
+		// marathon matches apps whose ID contains the value, so results are filtered again below
+		params.Set("id", spec.id)
+	}
+	list, err := client.Applications(params)
+	if err != nil {
+		return nil, err
+	}
+	apps := []*marathon.Application{}
+	for i := range list.Apps {
+		if spec.matches(list.Apps[i].ID) {
+			apps = append(apps, &list.Apps[i])
+		}
+	}
+	return apps, nil
 }
@@ -0,0 +1,90 @@
+package marathonlocator
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeMarathon serves the subset of the marathon API used by the locator
+type fakeMarathon struct {
+	// apps maps app IDs to their JSON definitions
+	apps   map[string]string
+	events chan string
+	done   chan struct{}
+}
+
+func newFakeMarathon() *fakeMarathon {
+	return &fakeMarathon{apps: make(map[string]string), events: make(chan string, 10), done: make(chan struct{})}
+}
+
+func (m *fakeMarathon) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.URL.Path {
+	case "/ping":
+		fmt.Fprint(w, "pong")
+	case "/v2/apps":
+		apps := []string{}
+		for id, app := range m.apps {
+			if strings.Contains(id, req.URL.Query().Get("id")) {
+				apps = append(apps, app)
+			}
+		}
+		fmt.Fprintf(w, `{"apps":[%s]}`, strings.Join(apps, ","))
+	case "/v2/events":
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case event := <-m.events:
+				fmt.Fprintf(w, "data: %s\n\n", event)
+				w.(http.Flusher).Flush()
+			case <-m.done:
+				return
+			}
+		}
+	default:
+		if app, ok := m.apps[strings.TrimPrefix(req.URL.Path, "/v2/apps")]; ok {
+			fmt.Fprintf(w, `{"app":%s}`, app)
+			return
+		}
+		http.NotFound(w, req)
+	}
+}
+
+func awaitChange(changes <-chan struct{}, timeout time.Duration) bool {
+	select {
+	case <-changes:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func TestEventsTriggerChanges(t *testing.T) {
+	fake := newFakeMarathon()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	defer close(fake.done)
+
+	ml, err := NewMarathonLocator(server.URL, []string{"monitoring/prometheus"}, "", "", false)
+	assert.Nil(t, err)
+	changes := ml.(*marathonLocator).Changes()
+
+	fake.events <- `{"eventType":"status_update_event","appId":"/other","taskStatus":"TASK_RUNNING"}`
+	assert.False(t, awaitChange(changes, 250*time.Millisecond), "event for an unrelated app should be ignored")
+
+	fake.events <- `{"eventType":"status_update_event","appId":"/monitoring/prometheus","taskStatus":"TASK_KILLED"}`
+	assert.True(t, awaitChange(changes, 5*time.Second), "status update should trigger a change")
+
+	fake.events <- `{"eventType":"health_status_changed_event","appId":"/monitoring/prometheus","alive":false}`
+	assert.True(t, awaitChange(changes, 5*time.Second), "health change should trigger a change")
+
+	fake.events <- `{"eventType":"deployment_success","id":"d1","plan":{"steps":[{"actions":[{"action":"ScaleApplication","app":"/monitoring/prometheus"}]}]}}`
+	assert.True(t, awaitChange(changes, 5*time.Second), "deployment should trigger a change")
+}
@@ -0,0 +1,120 @@
+package locator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/api/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxConcurrentProbes bounds the number of targets which are probed at once
+	maxConcurrentProbes = 8
+	// probeTimeout bounds the time spent probing a single target
+	probeTimeout = connectionTimetout + readTimeout
+	// upTimeout bounds the 'up' query which determines whether a target is viable
+	upTimeout = 1 * time.Second
+)
+
+// probeDeadline bounds the time spent probing all of the targets of a locator; targets
+// which have not been probed by the deadline are reported with an error
+var probeDeadline = 10 * time.Second
+
+// ProbeTargets generates prometheus Client objects from a provided list of targets,
+// carrying over any labels attached to each target; targets are probed concurrently,
+// and the results of each probe are cached on the resulting endpoint
+func ProbeTargets(targets []*Target) ([]*PrometheusEndpoint, error) {
+	valid := make([]*Target, 0, len(targets))
+	for _, target := range targets {
+		if len(strings.Trim(target.Address, " ")) > 0 {
+			valid = append(valid, target)
+		}
+	}
+	if len(valid) == 0 {
+		return nil, fmt.Errorf("Unable to locate any potential endpoints")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), probeDeadline)
+	defer cancel()
+
+	endpoints := make([]*PrometheusEndpoint, len(valid))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < maxConcurrentProbes && w < len(valid); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				endpoints[i] = probe(ctx, valid[i])
+			}
+		}()
+	}
+	for i := range valid {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	return endpoints, nil
+}
+
+// probe scrapes the target's /metrics endpoint (since self-scraping of prometheus' own
+// metrics might not be configured) to determine its uptime, and then tests its query API
+func probe(ctx context.Context, target *Target) *PrometheusEndpoint {
+	addr := strings.Trim(target.Address, " ")
+	endpoint := &PrometheusEndpoint{Address: addr, Labels: target.Labels, NotReadyReason: target.NotReadyReason}
+	if !endpoint.Ready() {
+		if log.GetLevel() >= log.DebugLevel {
+			log.Debugf("Skipping probe of %s, which is not ready: %s", addr, target.NotReadyReason)
+		}
+		return endpoint
+	}
+	if ctx.Err() != nil {
+		endpoint.Error = fmt.Errorf("Not probed within the probe deadline of %s", probeDeadline)
+		log.Errorf("Failed to probe %v: %v", addr, endpoint.Error)
+		return endpoint
+	}
+
+	client, err := prometheus.New(prometheus.Config{
+		Address:   addr,
+		Transport: queryTransport,
+	})
+	if err != nil {
+		endpoint.Error = err
+		log.Errorf("Failed to resolve build_info and uptime for %v: %v", addr, err)
+		return endpoint
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	if log.GetLevel() >= log.DebugLevel {
+		log.Debugf("Testing %s/metrics", addr)
+	}
+	endpoint.samples, endpoint.scrapeErr = scrape(ctx, addr)
+	endpoint.scraped = true
+	if endpoint.scrapeErr != nil {
+		endpoint.Error = endpoint.scrapeErr
+		log.Errorf("Failed to resolve build_info and uptime for %v: %v", addr, endpoint.Error)
+		return endpoint
+	}
+
+	if scraped := findSamples(endpoint.samples, "process_start_time_seconds"); len(scraped) > 0 {
+		endpoint.Uptime = time.Duration(time.Now().UTC().Unix()-int64(scraped[0].Value)) * time.Second
+		if log.GetLevel() >= log.DebugLevel {
+			log.Debugf("Parsed current uptime for %s: %s", addr, endpoint.Uptime)
+		}
+	}
+
+	endpoint.QueryAPI = prometheus.NewQueryAPI(client)
+	upCtx, upCancel := context.WithTimeout(ctx, upTimeout)
+	_, endpoint.upErr = endpoint.QueryAPI.Query(upCtx, "up", time.Now())
+	upCancel()
+	endpoint.upChecked = true
+	if endpoint.upErr != nil && log.GetLevel() >= log.DebugLevel {
+		log.Debugf("Query 'up' returned error: %v", endpoint.upErr)
+	}
+	return endpoint
+}
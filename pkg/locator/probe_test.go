@@ -0,0 +1,104 @@
+package locator
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/matt-deboer/mpp/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+const metricsResponse = `# TYPE process_start_time_seconds gauge
+process_start_time_seconds 1.5021274556e+09
+# TYPE prometheus_build_info gauge
+prometheus_build_info{version="1.5.2"} 1
+`
+
+func TestProbeTargetsConcurrentlyAndCachesResults(t *testing.T) {
+	var targets []*Target
+	var proms []*testhelpers.FakePrometheus
+	for i := 0; i < 4; i++ {
+		prom := &testhelpers.FakePrometheus{Metrics: metricsResponse, Delay: 500 * time.Millisecond}
+		server := httptest.NewServer(prom)
+		defer server.Close()
+		proms = append(proms, prom)
+		targets = append(targets, &Target{Address: server.URL})
+	}
+
+	start := time.Now()
+	endpoints, err := ProbeTargets(targets)
+	elapsed := time.Now().Sub(start)
+	assert.Nil(t, err)
+	assert.Len(t, endpoints, 4)
+	// each probe performs two requests; sequential probing would take 4s
+	assert.True(t, elapsed < 2*time.Second, "Expected concurrent probing; took %s", elapsed)
+
+	for i, endpoint := range endpoints {
+		assert.Equal(t, targets[i].Address, endpoint.Address)
+		assert.Nil(t, endpoint.Error)
+		assert.True(t, endpoint.Uptime > 0)
+		assert.True(t, endpoint.Viable())
+		value, err := endpoint.Metric("prometheus_build_info")
+		assert.Nil(t, err)
+		assert.Equal(t, `{version="1.5.2"}`, value.Labels)
+		assert.Equal(t, 1, proms[i].Scrapes(), "Expected a single scrape of %s", endpoint)
+	}
+}
+
+func TestProbeTargetsDeadline(t *testing.T) {
+	defer func(deadline time.Duration) { probeDeadline = deadline }(probeDeadline)
+	probeDeadline = 500 * time.Millisecond
+
+	// a black-holed host accepts connections, but never responds
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	prom := testhelpers.NewFakePrometheus(metricsResponse, nil)
+	defer prom.Close()
+
+	start := time.Now()
+	endpoints, err := ProbeTargets([]*Target{
+		{Address: "http://" + listener.Addr().String()},
+		{Address: prom.URL},
+		{Address: "http://10.0.0.1:9090", NotReadyReason: "pod is not ready"},
+	})
+	elapsed := time.Now().Sub(start)
+	assert.Nil(t, err)
+	assert.True(t, elapsed < 2*time.Second, "Expected probing to respect the deadline; took %s", elapsed)
+
+	assert.NotNil(t, endpoints[0].Error)
+	assert.False(t, endpoints[0].Viable())
+	assert.Nil(t, endpoints[1].Error)
+	assert.True(t, endpoints[1].Viable())
+	assert.False(t, endpoints[2].Ready())
+	assert.Nil(t, endpoints[2].QueryAPI)
+}
+
+func TestProbeTargetsWithInsecureCerts(t *testing.T) {
+	defer SetInsecureCerts(false)
+
+	prom := httptest.NewTLSServer(&testhelpers.FakePrometheus{Metrics: metricsResponse})
+	defer prom.Close()
+
+	endpoints, err := ProbeTargets([]*Target{{Address: prom.URL}})
+	assert.Nil(t, err)
+	assert.NotNil(t, endpoints[0].Error)
+
+	SetInsecureCerts(true)
+	endpoints, err = ProbeTargets([]*Target{{Address: prom.URL}})
+	assert.Nil(t, err)
+	assert.Nil(t, endpoints[0].Error)
+	assert.True(t, endpoints[0].Viable())
+}
@@ -0,0 +1,296 @@
+package locator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+// acceptHeader prefers the delimited protobuf format, falling back to the text format
+const acceptHeader = `application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.7,text/plain;version=0.0.4;q=0.3`
+
+// openMetricsType is the media type of the OpenMetrics text format, which some
+// exporters serve regardless of the requested format
+const openMetricsType = "application/openmetrics-text"
+
+// LabeledValue represents a persed metric instance
+type LabeledValue struct {
+	Name   string
+	Labels string
+	Value  float64
+	// Metric contains the full label set of the instance, including its name
+	Metric model.Metric
+}
+
+func (lv *LabeledValue) String() string {
+	return fmt.Sprintf("%s%s %f", lv.Name, lv.Labels, lv.Value)
+}
+
+// Label returns the value of the named label of the instance, or the empty string if it is not set
+func (lv *LabeledValue) Label(name string) string {
+	return string(lv.Metric[model.LabelName(name)])
+}
+
+// MatchType is the type of comparison performed by a LabelMatcher
+type MatchType int
+
+// Possible MatchTypes
+const (
+	MatchEqual MatchType = iota
+	MatchNotEqual
+	MatchRegexp
+	MatchNotRegexp
+)
+
+// LabelMatcher selects metric instances by the value of one of their labels, in the
+// manner of the label matchers of a prometheus query; labels which are not set match
+// as the empty string
+type LabelMatcher struct {
+	Type  MatchType
+	Name  string
+	Value string
+	re    *regexp.Regexp
+}
+
+// NewLabelMatcher returns a matcher of the provided type; for regular expression matchers,
+// the expression must match the entire value of the label
+func NewLabelMatcher(t MatchType, name, value string) (*LabelMatcher, error) {
+	m := &LabelMatcher{Type: t, Name: name, Value: value}
+	if t == MatchRegexp || t == MatchNotRegexp {
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("Invalid regular expression for label %s: %v", name, err)
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// Matches returns true if the label value satisfies the matcher
+func (m *LabelMatcher) Matches(value string) bool {
+	switch m.Type {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(value)
+	case MatchNotRegexp:
+		return !m.re.MatchString(value)
+	}
+	return false
+}
+
+// Metric returns the first instance of the named metric exposed by the endpoint's /metrics,
+// or nil if the metric is not exposed; the endpoint is scraped at most once (i.e., once per
+// selection round), normally while it is probed
+func (pe *PrometheusEndpoint) Metric(name string, matchers ...*LabelMatcher) (*LabeledValue, error) {
+	values, err := pe.Metrics(name, matchers...)
+	if err != nil || len(values) == 0 {
+		return nil, err
+	}
+	return values[0], nil
+}
+
+// Metrics returns all instances of the named metric exposed by the endpoint's /metrics which
+// satisfy the provided matchers; the endpoint is scraped at most once (i.e., once per
+// selection round), normally while it is probed
+func (pe *PrometheusEndpoint) Metrics(name string, matchers ...*LabelMatcher) ([]*LabeledValue, error) {
+	pe.mutex.Lock()
+	if !pe.scraped {
+		ctx, cancel := context.WithTimeout(context.TODO(), probeTimeout)
+		pe.samples, pe.scrapeErr = scrape(ctx, pe.Address)
+		cancel()
+		pe.scraped = true
+	}
+	samples, err := pe.samples, pe.scrapeErr
+	pe.mutex.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	return findSamples(samples, name, matchers...), nil
+}
+
+// ScrapeMetric scrapes the /metrics endpoint of the prometheus instance at addr, returning
+// the first instance of the named metric which satisfies the provided matchers, or nil if there is none
+func ScrapeMetric(addr string, name string, matchers ...*LabelMatcher) (*LabeledValue, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), probeTimeout)
+	defer cancel()
+	samples, err := scrape(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	if values := findSamples(samples, name, matchers...); len(values) > 0 {
+		return values[0], nil
+	}
+	return nil, nil
+}
+
+// scrape fetches and decodes the samples exposed by the /metrics endpoint of the prometheus
+// instance at addr, negotiating either the protobuf or text exposition format
+func scrape(ctx context.Context, addr string) (model.Vector, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/metrics", strings.TrimRight(addr, "/")), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", acceptHeader)
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s/metrics returned %d", addr, resp.StatusCode)
+	}
+	samples, err := decodeSamples(resp.Body, resp.Header)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse %s/metrics: %v", addr, err)
+	}
+	return samples, nil
+}
+
+// decodeSamples decodes all samples from the body of a /metrics response
+func decodeSamples(body io.Reader, header http.Header) (model.Vector, error) {
+	format := expfmt.ResponseFormat(header)
+	if mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type")); err == nil && mediaType == openMetricsType {
+		b, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(openMetricsToText(b))
+		format = expfmt.FmtText
+	}
+
+	decoder := &expfmt.SampleDecoder{
+		Dec:  expfmt.NewDecoder(body, format),
+		Opts: &expfmt.DecodeOptions{Timestamp: model.Now()},
+	}
+	var samples model.Vector
+	for {
+		var v model.Vector
+		if err := decoder.Decode(&v); err == io.EOF {
+			return samples, nil
+		} else if err != nil {
+			return nil, err
+		}
+		samples = append(samples, v...)
+	}
+}
+
+// findSamples returns the samples of the named metric which satisfy all of the matchers,
+// ordered by their labels
+func findSamples(samples model.Vector, name string, matchers ...*LabelMatcher) []*LabeledValue {
+	var values []*LabeledValue
+	for _, sample := range samples {
+		if string(sample.Metric[model.MetricNameLabel]) != name {
+			continue
+		}
+		matched := true
+		for _, m := range matchers {
+			if !m.Matches(string(sample.Metric[model.LabelName(m.Name)])) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			values = append(values, &LabeledValue{
+				Name:   name,
+				Labels: formatLabels(sample.Metric),
+				Value:  float64(sample.Value),
+				Metric: sample.Metric,
+			})
+		}
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Labels < values[j].Labels })
+	return values
+}
+
+// formatLabels formats the labels of the metric (excluding its name) as in the text exposition format
+func formatLabels(metric model.Metric) string {
+	names := make([]string, 0, len(metric))
+	for name := range metric {
+		if name != model.MetricNameLabel {
+			names = append(names, string(name))
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%q", name, metric[model.LabelName(name)])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// openMetricsToText rewrites the OpenMetrics text format into the prometheus text format: types
+// without an equivalent become untyped, exemplars are dropped, and timestamps (in seconds) are
+// converted to milliseconds; '# UNIT' and '# EOF' lines are ordinary comments in the text format
+func openMetricsToText(b []byte) []byte {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) == 4 && fields[1] == "TYPE" {
+				switch fields[3] {
+				case "counter", "gauge", "histogram", "summary":
+				default:
+					line = strings.Join(append(fields[:3], "untyped"), " ")
+				}
+			}
+		} else if len(line) > 0 {
+			series, rest := splitSeries(line)
+			if i := strings.Index(rest, "#"); i >= 0 {
+				rest = rest[:i]
+			}
+			fields := strings.Fields(rest)
+			if len(fields) == 2 {
+				if ts, err := strconv.ParseFloat(fields[1], 64); err == nil {
+					fields[1] = strconv.FormatInt(int64(ts*1000), 10)
+				}
+			}
+			line = series + " " + strings.Join(fields, " ")
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
+
+// splitSeries splits a sample line into its series (name and labels) and the remainder,
+// allowing for label values containing spaces, braces or escaped quotes
+func splitSeries(line string) (string, string) {
+	inQuotes, escaped := false, false
+	for i, c := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = inQuotes
+		case c == '"':
+			inQuotes = !inQuotes
+		case !inQuotes && c == '}':
+			return line[:i+1], line[i+1:]
+		case !inQuotes && c == ' ' && !strings.Contains(line[:i], "{"):
+			return line[:i], line[i:]
+		}
+	}
+	return line, ""
+}
@@ -0,0 +1,102 @@
+package locator
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+)
+
+const textMetrics = `# HELP prometheus_local_storage_memory_series The current number of series in memory.
+# TYPE prometheus_local_storage_memory_series gauge
+prometheus_local_storage_memory_series 2931
+# TYPE http_requests_total counter
+http_requests_total{handler="query",code="200"} 12 1502127455000
+http_requests_total{handler="query range",code="500"} 3 1502127455000
+http_requests_total{handler="query",code="500"} 1
+`
+
+const openMetrics = `# TYPE prometheus_build_info info
+prometheus_build_info{version="2.0.0",revision="a {b} c"} 1
+# TYPE http_requests counter
+# UNIT http_requests requests
+http_requests_total{handler="query"} 12 1502127455.123 # {trace_id="abc"} 1
+# EOF
+`
+
+func TestFindSamples(t *testing.T) {
+	samples, err := decodeSamples(strings.NewReader(textMetrics), http.Header{"Content-Type": {"text/plain; version=0.0.4"}})
+	assert.Nil(t, err)
+
+	values := findSamples(samples, "prometheus_local_storage_memory_series")
+	assert.Len(t, values, 1)
+	assert.Equal(t, "prometheus_local_storage_memory_series 2931.000000", values[0].String())
+
+	values = findSamples(samples, "http_requests_total")
+	assert.Len(t, values, 3)
+	assert.Equal(t, `{code="200",handler="query"}`, values[0].Labels)
+	assert.Equal(t, "query range", values[1].Label("handler"))
+
+	notOK, _ := NewLabelMatcher(MatchNotEqual, "code", "200")
+	query, _ := NewLabelMatcher(MatchRegexp, "handler", "query")
+	values = findSamples(samples, "http_requests_total", notOK, query)
+	assert.Len(t, values, 1)
+	assert.Equal(t, float64(1), values[0].Value)
+
+	assert.Empty(t, findSamples(samples, "prometheus_build_info"))
+
+	_, err = NewLabelMatcher(MatchRegexp, "handler", "(")
+	assert.NotNil(t, err)
+}
+
+func TestDecodeOpenMetrics(t *testing.T) {
+	samples, err := decodeSamples(strings.NewReader(openMetrics), http.Header{"Content-Type": {"application/openmetrics-text; version=0.0.1"}})
+	assert.Nil(t, err)
+
+	values := findSamples(samples, "prometheus_build_info")
+	assert.Len(t, values, 1)
+	assert.Equal(t, "a {b} c", values[0].Label("revision"))
+
+	values = findSamples(samples, "http_requests_total")
+	assert.Len(t, values, 1)
+	assert.Equal(t, float64(12), values[0].Value)
+}
+
+func TestScrapeNegotiatesProtobuf(t *testing.T) {
+	families := []*dto.MetricFamily{{
+		Name: proto.String("prometheus_build_info"),
+		Type: dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{{
+			Label: []*dto.LabelPair{{Name: proto.String("version"), Value: proto.String("1.7.1")}},
+			Gauge: &dto.Gauge{Value: proto.Float64(1)},
+		}},
+	}}
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format := expfmt.Negotiate(r.Header)
+		contentType = string(format)
+		w.Header().Set("Content-Type", contentType)
+		enc := expfmt.NewEncoder(w, format)
+		for _, mf := range families {
+			enc.Encode(mf)
+		}
+	}))
+	defer server.Close()
+
+	samples, err := scrape(context.Background(), server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, string(expfmt.FmtProtoDelim), contentType)
+	values := findSamples(samples, "prometheus_build_info")
+	assert.Len(t, values, 1)
+	assert.Equal(t, "1.7.1", values[0].Label("version"))
+
+	value, err := ScrapeMetric(server.URL, "prometheus_build_info")
+	assert.Nil(t, err)
+	assert.Equal(t, `prometheus_build_info{version="1.7.1"} 1.000000`, value.String())
+}
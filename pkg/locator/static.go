@@ -0,0 +1,147 @@
+package locator
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// watchRetryDelay is the delay before re-establishing a watch on the endpoints file after it stops
+var watchRetryDelay = 30 * time.Second
+
+type staticLocator struct {
+	endpointsFile string
+	targets       []*Target
+	watcher       io.Closer
+	changes       chan struct{}
+	mutex         sync.RWMutex
+}
+
+// NewEndpointsFileLocator returns a new Locator which reads a set of endpoints
+// from a file path; files ending in '.json', '.yml' or '.yaml' are parsed as
+// prometheus file_sd_configs target groups, otherwise one endpoint per line is expected.
+// Where supported, the file (and its parent directory) are watched for changes;
+// otherwise, or while a failed watch is being re-established, the file is re-read
+// each time endpoints are requested
+func NewEndpointsFileLocator(endpointsFile string) Locator {
+	sl := &staticLocator{
+		endpointsFile: endpointsFile,
+		changes:       make(chan struct{}, 1),
+	}
+	if _, err := sl.reload(); err != nil {
+		log.Errorf("Failed to read endpoints file %s: %v", endpointsFile, err)
+	}
+	if err := sl.watch(); err != nil {
+		log.Warnf("Unable to watch endpoints file %s; it will be re-read at every selection interval: %v",
+			endpointsFile, err)
+	}
+	return sl
+}
+
+func (sl *staticLocator) watch() error {
+	watcher, err := watchFile(sl.endpointsFile, sl.onChange, sl.onWatchStopped)
+	if err != nil {
+		return err
+	}
+	log.Infof("Watching endpoints file %s for changes", sl.endpointsFile)
+	sl.mutex.Lock()
+	sl.watcher = watcher
+	sl.mutex.Unlock()
+	return nil
+}
+
+// onWatchStopped falls back to re-reading the endpoints file at every selection
+// interval, and attempts to re-establish the watch after watchRetryDelay
+func (sl *staticLocator) onWatchStopped() {
+	log.Warnf("Endpoints file %s will be re-read at every selection interval until it is watched again in %v",
+		sl.endpointsFile, watchRetryDelay)
+	sl.mutex.Lock()
+	sl.watcher = nil
+	sl.mutex.Unlock()
+	time.AfterFunc(watchRetryDelay, func() {
+		if err := sl.watch(); err != nil {
+			log.Errorf("Failed to re-establish watch on endpoints file %s: %v", sl.endpointsFile, err)
+			sl.onWatchStopped()
+			return
+		}
+		// pick up any changes made while unwatched
+		sl.onChange()
+	})
+}
+
+func (sl *staticLocator) watching() bool {
+	sl.mutex.RLock()
+	defer sl.mutex.RUnlock()
+	return sl.watcher != nil
+}
+
+func (sl *staticLocator) String() string {
+	return fmt.Sprintf("%T{file: %s}", sl, sl.endpointsFile)
+}
+
+// Changes provides a channel which receives a value whenever the candidate endpoints change
+func (sl *staticLocator) Changes() <-chan struct{} {
+	return sl.changes
+}
+
+// Endpoints provides a list of candidate prometheus endpoints
+func (sl *staticLocator) Endpoints() ([]*PrometheusEndpoint, error) {
+	targets, err := sl.currentTargets()
+	if err != nil {
+		return nil, err
+	}
+	return ProbeTargets(targets)
+}
+
+// currentTargets returns the most recent valid set of targets, re-reading the
+// endpoints file when it is not being watched
+func (sl *staticLocator) currentTargets() ([]*Target, error) {
+	if !sl.watching() {
+		if _, err := sl.reload(); err != nil {
+			log.Errorf("Failed to read endpoints file %s; using last valid endpoints: %v", sl.endpointsFile, err)
+		}
+	}
+	sl.mutex.RLock()
+	defer sl.mutex.RUnlock()
+	if sl.targets == nil {
+		return nil, fmt.Errorf("No valid endpoints have been read from %s", sl.endpointsFile)
+	}
+	return sl.targets, nil
+}
+
+// reload re-reads the endpoints file, retaining the previous targets if the file
+// cannot be read or parsed, or is empty (as it may be while being rewritten);
+// returns true if the targets were changed
+func (sl *staticLocator) reload() (bool, error) {
+	targets, err := ReadEndpointsFile(sl.endpointsFile)
+	if err != nil {
+		return false, err
+	}
+	if len(targets) == 0 {
+		return false, fmt.Errorf("No endpoints found in %s", sl.endpointsFile)
+	}
+	sl.mutex.Lock()
+	defer sl.mutex.Unlock()
+	if reflect.DeepEqual(targets, sl.targets) {
+		return false, nil
+	}
+	sl.targets = targets
+	return true, nil
+}
+
+func (sl *staticLocator) onChange() {
+	changed, err := sl.reload()
+	if err != nil {
+		log.Errorf("Failed to reload endpoints file %s; keeping last valid endpoints: %v", sl.endpointsFile, err)
+	} else if changed {
+		log.Infof("Endpoints file %s has changed", sl.endpointsFile)
+		select {
+		case sl.changes <- struct{}{}:
+		default:
+		}
+	}
+}
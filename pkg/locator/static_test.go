@@ -0,0 +1,107 @@
+package locator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func awaitChange(t *testing.T, sl *staticLocator) {
+	select {
+	case <-sl.Changes():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a change notification")
+	}
+}
+
+func addresses(t *testing.T, sl *staticLocator) []string {
+	targets, err := sl.currentTargets()
+	assert.NoError(t, err)
+	addrs := make([]string, 0, len(targets))
+	for _, target := range targets {
+		addrs = append(addrs, target.Address)
+	}
+	return addrs
+}
+
+func TestEndpointsFileWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mpp-endpoints")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// mimic the layout of a kubernetes ConfigMap volume
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "..v1"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "..v1", "endpoints.json"),
+		[]byte(`[{"targets": ["10.0.0.1:9090"]}]`), 0644))
+	assert.NoError(t, os.Symlink("..v1", filepath.Join(dir, "..data")))
+	assert.NoError(t, os.Symlink(filepath.Join("..data", "endpoints.json"), filepath.Join(dir, "endpoints.json")))
+
+	sl := NewEndpointsFileLocator(filepath.Join(dir, "endpoints.json")).(*staticLocator)
+	if !sl.watching() {
+		t.Skip("File watching is not supported on this platform")
+	}
+	assert.Equal(t, []string{"http://10.0.0.1:9090"}, addresses(t, sl))
+
+	// atomically swap the data directory
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "..v2"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "..v2", "endpoints.json"),
+		[]byte(`[{"targets": ["10.0.0.1:9090", "10.0.0.2:9090"]}]`), 0644))
+	assert.NoError(t, os.Symlink("..v2", filepath.Join(dir, "..data_tmp")))
+	assert.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	awaitChange(t, sl)
+	assert.Equal(t, []string{"http://10.0.0.1:9090", "http://10.0.0.2:9090"}, addresses(t, sl))
+
+	// an invalid file leaves the last valid endpoints in place
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "..v2", "endpoints.json"), []byte(`[{"targets": `), 0644))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, []string{"http://10.0.0.1:9090", "http://10.0.0.2:9090"}, addresses(t, sl))
+
+	// in-place modification of the target file
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "..v2", "endpoints.json"),
+		[]byte(`[{"targets": ["10.0.0.3:9090"]}]`), 0644))
+	awaitChange(t, sl)
+	assert.Equal(t, []string{"http://10.0.0.3:9090"}, addresses(t, sl))
+}
+
+func TestEndpointsFileWatchStopped(t *testing.T) {
+	defer func(delay time.Duration) { watchRetryDelay = delay }(watchRetryDelay)
+	watchRetryDelay = 200 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "mpp-endpoints")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "endpoints.txt")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("http://10.0.0.1:9090\n"), 0644))
+
+	sl := NewEndpointsFileLocator(file).(*staticLocator)
+	if !sl.watching() {
+		t.Skip("File watching is not supported on this platform")
+	}
+
+	// closing the watch's descriptor stops it
+	sl.mutex.RLock()
+	assert.NoError(t, sl.watcher.Close())
+	sl.mutex.RUnlock()
+	deadline := time.Now().Add(5 * time.Second)
+	for sl.watching() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.False(t, sl.watching())
+
+	// the file is re-read while unwatched
+	assert.NoError(t, ioutil.WriteFile(file, []byte("http://10.0.0.2:9090\n"), 0644))
+	assert.Equal(t, []string{"http://10.0.0.2:9090"}, addresses(t, sl))
+
+	// and changes are picked up again once the watch is re-established
+	for !sl.watching() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, sl.watching())
+	assert.NoError(t, ioutil.WriteFile(file, []byte("http://10.0.0.3:9090\n"), 0644))
+	awaitChange(t, sl)
+	assert.Equal(t, []string{"http://10.0.0.3:9090"}, addresses(t, sl))
+}
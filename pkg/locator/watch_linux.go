@@ -0,0 +1,76 @@
+package locator
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	fileWatchMask = unix.IN_MODIFY | unix.IN_CLOSE_WRITE | unix.IN_ATTRIB |
+		unix.IN_DELETE_SELF | unix.IN_MOVE_SELF
+	dirWatchMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_TO | unix.IN_MOVED_FROM |
+		unix.IN_MODIFY | unix.IN_CLOSE_WRITE
+)
+
+// watchFile uses inotify to watch the provided file, invoking onChange whenever
+// it may have been modified; the parent directory of the file (and of the file's
+// symlink target, if any) are also watched, as kubernetes ConfigMap volumes update
+// their contents by atomically swapping a symlinked directory. onStop is invoked
+// if the watch fails after being established, or is closed
+func watchFile(path string, onChange func(), onStop func()) (io.Closer, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	if err = addWatches(fd, path); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	// a non-blocking descriptor is handled by the runtime poller, so closing the
+	// file interrupts a pending read
+	file := os.NewFile(uintptr(fd), "inotify")
+
+	go func() {
+		defer onStop()
+		defer file.Close()
+		buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+		for {
+			n, err := file.Read(buf)
+			if err != nil || n <= 0 {
+				log.Errorf("Stopped watching %s: %v", path, err)
+				return
+			}
+			if log.GetLevel() >= log.DebugLevel {
+				log.Debugf("Received inotify event(s) for %s", path)
+			}
+			// the file and/or its symlink target may have been replaced; refresh the watches
+			if err := addWatches(fd, path); err != nil {
+				log.Warnf("Failed to refresh watches for %s: %v", path, err)
+			}
+			onChange()
+		}
+	}()
+	return file, nil
+}
+
+func addWatches(fd int, path string) error {
+	dirs := []string{filepath.Dir(path)}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		if _, err := unix.InotifyAddWatch(fd, resolved, fileWatchMask); err != nil {
+			return os.NewSyscallError("inotify_add_watch", err)
+		}
+		if dir := filepath.Dir(resolved); dir != dirs[0] {
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, dir := range dirs {
+		if _, err := unix.InotifyAddWatch(fd, dir, dirWatchMask); err != nil {
+			return os.NewSyscallError("inotify_add_watch", err)
+		}
+	}
+	return nil
+}
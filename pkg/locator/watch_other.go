@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package locator
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// watchFile is only supported on linux
+func watchFile(path string, onChange func(), onStop func()) (io.Closer, error) {
+	return nil, fmt.Errorf("file watching is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,73 @@
+package locator
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// WeightLabel is the label carrying the relative weight of an endpoint, used by strategies
+// which distribute traffic amongst multiple endpoints in proportion to their weights
+const WeightLabel = "weight"
+
+// Weight returns the relative weight of the endpoint, from its 'weight' label; endpoints which
+// have no (valid) weight have a weight of 1
+func (pe *PrometheusEndpoint) Weight() float64 {
+	value, ok := pe.Labels[WeightLabel]
+	if !ok {
+		return 1
+	}
+	weight, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || weight < 0 || math.IsInf(weight, 0) || math.IsNaN(weight) {
+		log.Warnf("Ignoring invalid weight '%s' of endpoint %v", value, pe)
+		return 1
+	}
+	return weight
+}
+
+// SelectWeighted selects all viable endpoints out of the provided set, for strategies which
+// distribute requests amongst them in proportion to their weights; endpoints with a weight
+// of 0 are considered to be drained, and are not selected. The weights of the selected
+// endpoints are returned by BackendKey
+func SelectWeighted(endpoints []*PrometheusEndpoint) (map[string]float64, error) {
+	weights := make(map[string]float64)
+	for _, endpoint := range endpoints {
+		endpoint.Selected = false
+		if endpoint.QueryAPI != nil && endpoint.Error == nil && endpoint.Viable() {
+			target, err := url.ParseRequestURI(endpoint.Address)
+			if err != nil {
+				continue
+			}
+			weight := endpoint.Weight()
+			endpoint.ComparisonMetricValue = strconv.FormatFloat(weight, 'g', -1, 64)
+			if weight > 0 {
+				endpoint.Selected = true
+				weights[BackendKey(target)] = weight
+			}
+		}
+	}
+	if len(weights) == 0 {
+		return weights, fmt.Errorf("No valid/responding endpoints found in the provided list: %v", endpoints)
+	}
+	return weights, nil
+}
+
+// TargetWeights returns the weight of each of the provided targets, as returned by SelectWeighted,
+// along with their total; targets which are not found have a weight of 1
+func TargetWeights(weights map[string]float64, targets []*url.URL) ([]float64, float64) {
+	result := make([]float64, len(targets))
+	var total float64
+	for i, target := range targets {
+		weight, ok := weights[BackendKey(target)]
+		if !ok {
+			weight = 1
+		}
+		result[i] = weight
+		total += weight
+	}
+	return result, total
+}
@@ -0,0 +1,73 @@
+package locator
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/api/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeQueryAPI struct{}
+
+func (q *fakeQueryAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, error) {
+	return model.Vector{}, nil
+}
+
+func (q *fakeQueryAPI) QueryRange(ctx context.Context, query string, r prometheus.Range) (model.Value, error) {
+	return model.Matrix{}, nil
+}
+
+func weightedEndpoint(addr string, weight string) *PrometheusEndpoint {
+	endpoint := &PrometheusEndpoint{Address: addr, QueryAPI: &fakeQueryAPI{}}
+	if len(weight) > 0 {
+		endpoint.Labels = map[string]string{WeightLabel: weight}
+	}
+	return endpoint
+}
+
+func TestSelectWeighted(t *testing.T) {
+	endpoints := []*PrometheusEndpoint{
+		weightedEndpoint("http://a:9090", "5"),
+		weightedEndpoint("http://b:9090", ""),
+		weightedEndpoint("http://c:9090", " 0.5 "),
+		weightedEndpoint("http://d:9090", "0"),
+		weightedEndpoint("http://e:9090", "-1"),
+		{Address: "http://f:9090"},
+	}
+	weights, err := SelectWeighted(endpoints)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]float64{
+		"http://a:9090": 5,
+		"http://b:9090": 1,
+		"http://c:9090": 0.5,
+		"http://e:9090": 1,
+	}, weights)
+	var selected []bool
+	for _, endpoint := range endpoints {
+		selected = append(selected, endpoint.Selected)
+	}
+	assert.Equal(t, []bool{true, true, true, false, true, false}, selected)
+	assert.Equal(t, "5", endpoints[0].ComparisonMetricValue)
+	assert.Equal(t, "0", endpoints[3].ComparisonMetricValue)
+
+	// drained endpoints alone are no valid selection
+	weights, err = SelectWeighted(endpoints[3:4])
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(weights))
+	assert.False(t, endpoints[3].Selected)
+}
+
+func TestTargetWeights(t *testing.T) {
+	var targets []*url.URL
+	for _, addr := range []string{"http://a:9090", "http://b:9090"} {
+		u, _ := url.Parse(addr)
+		targets = append(targets, u)
+	}
+	weights, total := TargetWeights(map[string]float64{"http://a:9090": 3}, targets)
+	assert.Equal(t, []float64{3, 1}, weights)
+	assert.Equal(t, 4.0, total)
+}
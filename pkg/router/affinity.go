@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/url"
 
+	"github.com/matt-deboer/mpp/pkg/locator"
 	log "github.com/sirupsen/logrus"
 	"github.com/hashicorp/golang-lru"
 )
@@ -86,7 +87,7 @@ func (a *affinityProvider) preferredTarget(req *http.Request, router *Router) *u
 				u, err := url.Parse(cookie.Value)
 				if err != nil {
 					log.Errorf("Sticky cookie contained unparsable url %s: %v", cookie.Value, err)
-				} else if !contains(router.selection.Selection, u) {
+				} else if !contains(router.selection.Selection, u) || !router.routable(u) {
 					if log.GetLevel() >= log.DebugLevel {
 						log.Debugf("Sticky cookie target %v is no longer valid", u)
 					}
@@ -101,7 +102,7 @@ func (a *affinityProvider) preferredTarget(req *http.Request, router *Router) *u
 			}
 		}
 		if a.sourceIPEnabled {
-			if u, ok := ipRoutes.Get(getSourceIPKey(req)); ok {
+			if u, ok := ipRoutes.Get(getSourceIPKey(req)); ok && router.routable(u.(*url.URL)) {
 				router.metrics.affinityHits.WithLabelValues(AffinityBySourceIP.String()).Inc()
 				return u.(*url.URL)
 			}
@@ -120,9 +121,9 @@ func getSourceIPKey(req *http.Request) int64 {
 }
 
 // cache the preferred target, based on selected affinity option(s)
-func (a *affinityProvider) savePreferredTarget(w http.ResponseWriter, req *http.Request, needsCookie bool) {
+func (a *affinityProvider) savePreferredTarget(w http.ResponseWriter, req *http.Request, target *url.URL, needsCookie bool) {
 	if needsCookie {
-		backend := backend(req.URL)
+		backend := locator.BackendKey(target)
 		http.SetCookie(w, &http.Cookie{
 			Name:     cookieName,
 			Value:    backend,
@@ -133,6 +134,6 @@ func (a *affinityProvider) savePreferredTarget(w http.ResponseWriter, req *http.
 		}
 	}
 	if a.sourceIPEnabled {
-		ipRoutes.Add(getSourceIPKey(req), req.URL)
+		ipRoutes.Add(getSourceIPKey(req), target)
 	}
 }
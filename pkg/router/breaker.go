@@ -0,0 +1,272 @@
+package router
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	log "github.com/sirupsen/logrus"
+)
+
+// CircuitBreaker configures a circuit breaker for each selected backend, which stops requests
+// to a backend whose requests are failing, and restores them once probe requests succeed
+type CircuitBreaker struct {
+	// ConsecutiveFailures is the number of consecutive failed requests which trips the breaker; 0 disables it
+	ConsecutiveFailures int
+	// ErrorRatio is the ratio of failed requests within Window which trips the breaker; 0 disables it
+	ErrorRatio float64
+	Window     time.Duration
+	// MinRequests is the number of requests within the window required to trip the breaker by ErrorRatio
+	MinRequests int
+	// OpenTime is the period for which a tripped breaker stops requests, before allowing probe requests
+	OpenTime time.Duration
+	// ProbeRequests is the number of probe requests which must succeed to close the breaker
+	ProbeRequests int
+}
+
+// Enabled answers whether circuit breakers are to be used
+func (c CircuitBreaker) Enabled() bool {
+	return c.ConsecutiveFailures > 0 || c.ErrorRatio > 0
+}
+
+func (c CircuitBreaker) validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if c.ErrorRatio > 1 {
+		return fmt.Errorf("Invalid circuit breaker error ratio %v; must be between 0 and 1", c.ErrorRatio)
+	}
+	if c.ErrorRatio > 0 && c.Window < windowBuckets*time.Millisecond {
+		return fmt.Errorf("Invalid circuit breaker window %s; must be at least %s", c.Window, windowBuckets*time.Millisecond)
+	}
+	if c.OpenTime <= 0 {
+		return fmt.Errorf("Invalid circuit breaker open time %s; must be positive", c.OpenTime)
+	}
+	if c.ProbeRequests < 1 {
+		return fmt.Errorf("Invalid circuit breaker probe requests %d; must be at least 1", c.ProbeRequests)
+	}
+	return nil
+}
+
+// circuitState is the state of a backend's circuit breaker
+type circuitState int
+
+const (
+	// circuitClosed allows all requests
+	circuitClosed circuitState = iota
+	// circuitOpen stops all requests
+	circuitOpen
+	// circuitHalfOpen allows a limited number of probe requests
+	circuitHalfOpen
+)
+
+var circuitStateStrings = []string{"closed", "open", "half-open"}
+
+func (s circuitState) String() string {
+	return circuitStateStrings[int(s)]
+}
+
+// circuit tracks the requests to a backend, and the state of its breaker
+type circuit struct {
+	name        string
+	state       circuitState
+	window      slidingWindow
+	consecutive int
+	openedAt    time.Time
+	reason      string
+	// probes and successes count the requests allowed and succeeded while half-open
+	probes    int
+	successes int
+}
+
+// circuitBreakers maintains the circuit breaker of each backend
+type circuitBreakers struct {
+	options  CircuitBreaker
+	metrics  *metrics
+	mutex    sync.Mutex
+	circuits map[string]*circuit
+	now      func() time.Time
+}
+
+func newCircuitBreakers(options CircuitBreaker, m *metrics) *circuitBreakers {
+	return &circuitBreakers{
+		options:  options,
+		metrics:  m,
+		circuits: make(map[string]*circuit),
+		now:      time.Now,
+	}
+}
+
+// allow answers whether a request may be sent to the target, counting it as a probe
+// request if the target's breaker is half-open
+func (b *circuitBreakers) allow(target *url.URL) bool {
+	if !b.options.Enabled() {
+		return true
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	c, ok := b.circuits[locator.BackendKey(target)]
+	if !ok {
+		return true
+	}
+	if !b.permits(c, b.now()) {
+		return false
+	}
+	if c.state == circuitHalfOpen {
+		c.probes++
+	}
+	return true
+}
+
+// permitted answers whether the target's breaker allows requests, without counting a probe request
+func (b *circuitBreakers) permitted(target *url.URL) bool {
+	if !b.options.Enabled() {
+		return true
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	c, ok := b.circuits[locator.BackendKey(target)]
+	return !ok || b.permits(c, b.now())
+}
+
+// available returns the targets of the selection whose breakers allow requests
+func (b *circuitBreakers) available(selection []*url.URL) []*url.URL {
+	if !b.options.Enabled() {
+		return selection
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := b.now()
+	available := make([]*url.URL, 0, len(selection))
+	for _, target := range selection {
+		if c, ok := b.circuits[locator.BackendKey(target)]; !ok || b.permits(c, now) {
+			available = append(available, target)
+		}
+	}
+	if len(available) == 0 {
+		// requests are then refused by allow, rather than failing to route
+		return selection
+	}
+	return available
+}
+
+// permits answers whether the circuit allows a request at the provided time, moving an open
+// circuit to half-open once it has been open for the open time; the mutex must be held
+func (b *circuitBreakers) permits(c *circuit, now time.Time) bool {
+	if c.state == circuitOpen && now.Sub(c.openedAt) >= b.options.OpenTime {
+		log.Infof("Circuit breaker for backend %s is half-open; allowing %d probe requests", c.name, b.options.ProbeRequests)
+		b.transition(c, circuitHalfOpen)
+		c.probes, c.successes = 0, 0
+	}
+	switch c.state {
+	case circuitOpen:
+		return false
+	case circuitHalfOpen:
+		return c.probes < b.options.ProbeRequests
+	}
+	return true
+}
+
+// record accounts for the response to a request sent to the target, tripping or resetting its breaker
+func (b *circuitBreakers) record(target *url.URL, status int) {
+	if !b.options.Enabled() {
+		return
+	}
+	name := locator.BackendKey(target)
+	failed := status >= 500
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := b.now()
+	c, ok := b.circuits[name]
+	if !ok {
+		c = &circuit{name: name}
+		b.circuits[name] = c
+	}
+	switch c.state {
+	case circuitOpen:
+		// a request allowed before the breaker tripped
+		return
+	case circuitHalfOpen:
+		if failed {
+			b.trip(c, now, fmt.Sprintf("probe request failed with status %d", status))
+			return
+		}
+		c.successes++
+		if c.successes >= b.options.ProbeRequests {
+			log.Infof("Circuit breaker for backend %s is closed after %d successful probe requests", name, c.successes)
+			b.transition(c, circuitClosed)
+			c.window, c.consecutive = slidingWindow{}, 0
+		}
+		return
+	}
+
+	if failed {
+		c.consecutive++
+	} else {
+		c.consecutive = 0
+	}
+	if b.options.ConsecutiveFailures > 0 && c.consecutive >= b.options.ConsecutiveFailures {
+		b.trip(c, now, fmt.Sprintf("%d consecutive failed requests", c.consecutive))
+		return
+	}
+	if b.options.ErrorRatio > 0 {
+		c.window.add(now, b.options.Window, failed, 0)
+		requests, errors, _ := c.window.totals(now, b.options.Window)
+		if requests >= b.options.MinRequests && requests > 0 {
+			if ratio := float64(errors) / float64(requests); ratio >= b.options.ErrorRatio {
+				b.trip(c, now, fmt.Sprintf("error ratio %.2f over %d requests", ratio, requests))
+			}
+		}
+	}
+}
+
+// trip opens the circuit; the mutex must be held
+func (b *circuitBreakers) trip(c *circuit, now time.Time, reason string) {
+	log.Warnf("Circuit breaker for backend %s is open for %s: %s", c.name, b.options.OpenTime, reason)
+	b.transition(c, circuitOpen)
+	c.openedAt, c.reason = now, reason
+	b.metrics.circuitBreakerTrips.WithLabelValues(c.name).Inc()
+}
+
+func (b *circuitBreakers) transition(c *circuit, state circuitState) {
+	c.state = state
+	b.metrics.circuitBreakerState.WithLabelValues(c.name).Set(float64(state))
+}
+
+// states returns the state of each breaker which is not closed, by backend
+func (b *circuitBreakers) states() map[string]string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := b.now()
+	states := make(map[string]string)
+	for name, c := range b.circuits {
+		b.permits(c, now)
+		if c.state != circuitClosed {
+			states[name] = fmt.Sprintf("circuit %s: %s", c.state, c.reason)
+		}
+	}
+	return states
+}
+
+// forget discards the breakers of backends which are no longer candidates, and of those which
+// are neither selected nor tripped
+func (b *circuitBreakers) forget(selection []*url.URL, candidates []*locator.PrometheusEndpoint) {
+	keys := make(map[string]bool, len(candidates))
+	for _, endpoint := range candidates {
+		if target, err := url.Parse(endpoint.Address); err == nil {
+			keys[locator.BackendKey(target)] = true
+		}
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for name, c := range b.circuits {
+		if !keys[name] || (c.state == circuitClosed && !containsBackend(selection, name)) {
+			delete(b.circuits, name)
+			b.metrics.circuitBreakerState.DeleteLabelValues(name)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package router
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	options := CircuitBreaker{
+		ConsecutiveFailures: 3,
+		ErrorRatio:          0.5,
+		Window:              10 * time.Second,
+		MinRequests:         6,
+		OpenTime:            10 * time.Second,
+		ProbeRequests:       2,
+	}
+	now := time.Date(2017, 8, 7, 12, 0, 0, 0, time.UTC)
+	b := newCircuitBreakers(options, testMetrics())
+	b.now = func() time.Time { return now }
+
+	a, _ := url.Parse("http://a:9090")
+	c, _ := url.Parse("http://c:9090")
+	selection := []*url.URL{a, c}
+
+	// consecutive failures trip the breaker
+	for _, status := range []int{http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusOK} {
+		assert.True(t, b.allow(a))
+		b.record(a, status)
+	}
+	for i := 0; i < 3; i++ {
+		b.record(a, http.StatusBadGateway)
+	}
+	assert.False(t, b.allow(a))
+	assert.Equal(t, []*url.URL{c}, b.available(selection))
+	assert.Equal(t, map[string]string{"http://a:9090": "circuit open: 3 consecutive failed requests"}, b.states())
+
+	// once half-open, a limited number of probe requests are allowed
+	now = now.Add(10 * time.Second)
+	assert.True(t, b.permitted(a))
+	assert.True(t, b.allow(a))
+	assert.True(t, b.allow(a))
+	assert.False(t, b.allow(a))
+	assert.Equal(t, []*url.URL{c}, b.available(selection))
+
+	// a failed probe re-opens the breaker
+	b.record(a, http.StatusOK)
+	b.record(a, http.StatusGatewayTimeout)
+	assert.False(t, b.permitted(a))
+	assert.Equal(t, "circuit open: probe request failed with status 504", b.states()["http://a:9090"])
+
+	// successful probes close it
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, "circuit half-open: probe request failed with status 504", b.states()["http://a:9090"])
+	for i := 0; i < 2; i++ {
+		assert.True(t, b.allow(a))
+		b.record(a, http.StatusOK)
+	}
+	assert.True(t, b.allow(a))
+	assert.Equal(t, selection, b.available(selection))
+	assert.Equal(t, 0, len(b.states()))
+
+	// the error ratio trips the breaker once enough requests are made within the window
+	for _, status := range []int{500, 200, 500, 200, 500} {
+		b.record(c, status)
+	}
+	assert.True(t, b.permitted(c))
+	b.record(c, http.StatusOK)
+	assert.False(t, b.permitted(c))
+	assert.Equal(t, "circuit open: error ratio 0.50 over 6 requests", b.states()["http://c:9090"])
+
+	// all breakers being open leaves the selection intact, for requests to be refused
+	for i := 0; i < 3; i++ {
+		b.record(a, http.StatusInternalServerError)
+	}
+	assert.Equal(t, selection, b.available(selection))
+
+	// tripped breakers are retained while their backends remain candidates, but closed
+	// breakers of unselected backends are forgotten
+	b.record(c, http.StatusOK)
+	now = now.Add(10 * time.Second)
+	for i := 0; i < 2; i++ {
+		assert.True(t, b.allow(c))
+		b.record(c, http.StatusOK)
+	}
+	candidates := []*locator.PrometheusEndpoint{{Address: "http://a:9090"}, {Address: "http://c:9090"}}
+	b.forget(selection[:1], candidates)
+	assert.Equal(t, 1, len(b.circuits))
+	assert.Equal(t, "circuit half-open: 3 consecutive failed requests", b.states()["http://a:9090"])
+
+	// the breakers of backends which are no longer candidates are forgotten, whatever their state
+	b.forget(nil, candidates[1:])
+	assert.Equal(t, 0, len(b.circuits))
+	assert.True(t, b.permitted(a))
+
+	assert.Nil(t, CircuitBreaker{}.validate())
+	assert.NotNil(t, CircuitBreaker{ConsecutiveFailures: 5, OpenTime: time.Second}.validate())
+	assert.NotNil(t, CircuitBreaker{ErrorRatio: 0.5, OpenTime: time.Second, ProbeRequests: 1}.validate())
+}
@@ -4,7 +4,10 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/matt-deboer/mpp/pkg/selector"
 	log "github.com/sirupsen/logrus"
+	"github.com/vulcand/oxy/utils"
 )
 
 // internalRouter controls the actual low-level
@@ -27,21 +30,40 @@ func (i *internalRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			if log.GetLevel() >= log.DebugLevel {
 				log.Debugf("Router is reusing sticky session to %v", target)
 			}
-			req.URL.Scheme = target.Scheme
-			req.URL.Host = target.Host
+			rewrite(req.URL, target)
 		} else {
 			if log.GetLevel() >= log.DebugLevel {
 				log.Debugf("Router is selecting a new backend target")
 			}
-			i.router.rewriter(req.URL)
+			target = i.router.rewriter(req.URL)
+			if target == nil {
+				http.Error(w, "No backends available :(", 503)
+				return
+			}
+		}
+		if !i.router.breakers.allow(target) {
+			http.Error(w, "No backends available; circuit breaker is open :(", 503)
+			return
 		}
-		backend := backend(req.URL)
+		retryTarget(req, target)
+		backend := locator.BackendKey(target)
 		i.router.metrics.requestsByBackend.WithLabelValues(backend).Inc()
 
 		w.Header().Set("MPP.ServedBy", backend)
+		observer, observed := i.router.selector.Strategy.(selector.Observer)
+		if observed {
+			observer.RequestStarted(target)
+		}
 		start := time.Now()
-		i.router.forward.ServeHTTP(w, req)
-		i.router.metrics.responseTimeByBackend.WithLabelValues(backend).Add(time.Now().Sub(start).Seconds() * 1000)
-		i.affinity.savePreferredTarget(w, req, needsCookie)
+		pw := &utils.ProxyWriter{W: w}
+		i.router.forward.ServeHTTP(pw, req)
+		elapsed := time.Now().Sub(start)
+		i.router.metrics.responseTimeByBackend.WithLabelValues(backend).Add(elapsed.Seconds() * 1000)
+		if observed {
+			observer.RequestCompleted(target, elapsed)
+		}
+		i.router.outliers.record(target, pw.StatusCode(), elapsed)
+		i.router.breakers.record(target, pw.StatusCode())
+		i.affinity.savePreferredTarget(w, req, target, needsCookie)
 	}
 }
@@ -10,7 +10,12 @@ type metrics struct {
 	requestsByBackend     *prometheus.CounterVec
 	responseTimeByBackend *prometheus.CounterVec
 	selectionEvents       prometheus.Counter
+	selectionChanges      *prometheus.CounterVec
 	affinityHits          *prometheus.CounterVec
+	outlierEjections      *prometheus.CounterVec
+	ejectedBackends       prometheus.Gauge
+	circuitBreakerTrips   *prometheus.CounterVec
+	circuitBreakerState   *prometheus.GaugeVec
 }
 
 func newMetrics(metricsNamespace string) *metrics {
@@ -41,17 +46,47 @@ func newMetrics(metricsNamespace string) *metrics {
 			Name:      "selection_events",
 			Help:      "The number of selection events",
 		}),
+		selectionChanges: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "selection_changes",
+			Help:      "The number of selection events which changed the selected backends, by reason",
+		}, []string{"reason"}),
 		affinityHits: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Namespace: metricsNamespace,
 			Name:      "affinity_hits",
 			Help:      "The number of requests routed based on affinity match",
 		}, []string{"type"}),
+		outlierEjections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "outlier_ejections",
+			Help:      "The number of times a backend was ejected from the selection as an outlier, by reason",
+		}, []string{"backend", "reason"}),
+		ejectedBackends: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "ejected_backends",
+			Help:      "The number of backends currently ejected from the selection as outliers",
+		}),
+		circuitBreakerTrips: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "circuit_breaker_trips",
+			Help:      "The number of times the circuit breaker of a backend was opened",
+		}, []string{"backend"}),
+		circuitBreakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "circuit_breaker_state",
+			Help:      "The state of the circuit breaker of each backend: 0 (closed), 1 (open) or 2 (half-open)",
+		}, []string{"backend"}),
 	}
 	prometheus.MustRegister(m.selectedBackends)
 	prometheus.MustRegister(m.retriesByBackend)
 	prometheus.MustRegister(m.requestsByBackend)
 	prometheus.MustRegister(m.responseTimeByBackend)
 	prometheus.MustRegister(m.selectionEvents)
+	prometheus.MustRegister(m.selectionChanges)
 	prometheus.MustRegister(m.affinityHits)
+	prometheus.MustRegister(m.outlierEjections)
+	prometheus.MustRegister(m.ejectedBackends)
+	prometheus.MustRegister(m.circuitBreakerTrips)
+	prometheus.MustRegister(m.circuitBreakerState)
 	return m
 }
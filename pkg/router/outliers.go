@@ -0,0 +1,247 @@
+package router
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	log "github.com/sirupsen/logrus"
+)
+
+// OutlierDetection configures passive health checking of the selected backends, whereby backends
+// whose responses are failing or slow are temporarily ejected from the selection
+type OutlierDetection struct {
+	// Window is the sliding window over which the error ratio and latency of each backend are measured
+	Window time.Duration
+	// MinRequests is the number of requests a backend must receive within the window to be evaluated
+	MinRequests int
+	// ErrorRatio is the ratio of 5xx responses at which a backend is ejected; 0 disables the ratio
+	ErrorRatio float64
+	// Latency is the mean response latency at which a backend is ejected; 0 disables the latency
+	Latency time.Duration
+	// EjectionTime is the period of a backend's first ejection, which doubles with each consecutive
+	// ejection, up to MaxEjectionTime
+	EjectionTime    time.Duration
+	MaxEjectionTime time.Duration
+	// MaxEjectedRatio is the maximum ratio of the selected backends which may be ejected at once
+	MaxEjectedRatio float64
+}
+
+// Enabled answers whether outliers are to be detected
+func (o OutlierDetection) Enabled() bool {
+	return o.ErrorRatio > 0 || o.Latency > 0
+}
+
+func (o OutlierDetection) validate() error {
+	if !o.Enabled() {
+		return nil
+	}
+	if o.ErrorRatio > 1 {
+		return fmt.Errorf("Invalid outlier error ratio %v; must be between 0 and 1", o.ErrorRatio)
+	}
+	if o.Window < windowBuckets*time.Millisecond {
+		return fmt.Errorf("Invalid outlier detection window %s; must be at least %s", o.Window, windowBuckets*time.Millisecond)
+	}
+	if o.EjectionTime <= 0 || o.MaxEjectionTime < o.EjectionTime {
+		return fmt.Errorf("Invalid outlier ejection time %s (max %s); must be positive, and no more than the max",
+			o.EjectionTime, o.MaxEjectionTime)
+	}
+	if o.MaxEjectedRatio < 0 || o.MaxEjectedRatio > 1 {
+		return fmt.Errorf("Invalid max ejected ratio %v; must be between 0 and 1", o.MaxEjectedRatio)
+	}
+	return nil
+}
+
+// backendHealth tracks the recent responses and ejections of a backend
+type backendHealth struct {
+	name         string
+	window       slidingWindow
+	ejected      bool
+	ejections    int
+	ejectedUntil time.Time
+	reason       string
+}
+
+// Ejection describes the current ejection of a backend, for the status page
+type Ejection struct {
+	Until  time.Time
+	Count  int
+	Reason string
+}
+
+func (e *Ejection) String() string {
+	return fmt.Sprintf("%s (ejection #%d, until %s)", e.Reason, e.Count, e.Until.Format("15:04:05"))
+}
+
+// outlierDetector ejects backends from the selection based on their recent responses
+type outlierDetector struct {
+	options  OutlierDetection
+	metrics  *metrics
+	mutex    sync.Mutex
+	backends map[string]*backendHealth
+	// selection is the current selection, amongst which outliers are ejected
+	selection []*url.URL
+	now       func() time.Time
+}
+
+func newOutlierDetector(options OutlierDetection, m *metrics) *outlierDetector {
+	return &outlierDetector{
+		options:  options,
+		metrics:  m,
+		backends: make(map[string]*backendHealth),
+		now:      time.Now,
+	}
+}
+
+// record accounts for a response from the target, ejecting it if it has become an outlier
+// amongst the current selection
+func (d *outlierDetector) record(target *url.URL, status int, elapsed time.Duration) {
+	if !d.options.Enabled() {
+		return
+	}
+	name := locator.BackendKey(target)
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := d.now()
+	b, ok := d.backends[name]
+	if !ok {
+		b = &backendHealth{name: name}
+		d.backends[name] = b
+	}
+	if d.isEjected(b, now) {
+		return
+	}
+	b.window.add(now, d.options.Window, status >= 500, elapsed)
+
+	requests, errors, latency := b.window.totals(now, d.options.Window)
+	if requests < d.options.MinRequests || requests == 0 {
+		return
+	}
+	var reason, kind string
+	if ratio := float64(errors) / float64(requests); d.options.ErrorRatio > 0 && ratio >= d.options.ErrorRatio {
+		reason, kind = fmt.Sprintf("error ratio %.2f over %d requests", ratio, requests), "errors"
+	} else if mean := latency / time.Duration(requests); d.options.Latency > 0 && mean >= d.options.Latency {
+		reason, kind = fmt.Sprintf("mean latency %s over %d requests", mean.Truncate(time.Millisecond), requests), "latency"
+	} else {
+		return
+	}
+
+	selection := d.selection
+	ejected := 0
+	for _, t := range selection {
+		if other, ok := d.backends[locator.BackendKey(t)]; ok && d.isEjected(other, now) {
+			ejected++
+		}
+	}
+	if float64(ejected+1) > d.options.MaxEjectedRatio*float64(len(selection)) {
+		log.Warnf("Not ejecting outlier backend %s (%s); %d of %d selected backends are already ejected",
+			name, reason, ejected, len(selection))
+		return
+	}
+
+	// consecutive ejections are forgotten once the backend has stayed in service for the maximum ejection time
+	if b.ejections > 0 && now.Sub(b.ejectedUntil) >= d.options.MaxEjectionTime {
+		b.ejections = 0
+	}
+	b.ejections++
+	period := d.options.EjectionTime
+	for i := 1; i < b.ejections && period < d.options.MaxEjectionTime; i++ {
+		period *= 2
+	}
+	if period > d.options.MaxEjectionTime {
+		period = d.options.MaxEjectionTime
+	}
+	b.ejected, b.ejectedUntil, b.reason = true, now.Add(period), reason
+	b.window = slidingWindow{}
+
+	log.Warnf("Ejecting outlier backend %s for %s: %s", name, period, reason)
+	d.metrics.outlierEjections.WithLabelValues(name, kind).Inc()
+	d.metrics.ejectedBackends.Set(float64(ejected + 1))
+}
+
+// available returns the targets of the selection which are not currently ejected
+func (d *outlierDetector) available(selection []*url.URL) []*url.URL {
+	if !d.options.Enabled() {
+		return selection
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := d.now()
+	available := make([]*url.URL, 0, len(selection))
+	for _, target := range selection {
+		if b, ok := d.backends[locator.BackendKey(target)]; !ok || !d.isEjected(b, now) {
+			available = append(available, target)
+		}
+	}
+	if len(available) == 0 {
+		// never leave the selection without backends
+		return selection
+	}
+	return available
+}
+
+// ejected answers whether the target is currently ejected
+func (d *outlierDetector) ejected(target *url.URL) bool {
+	if !d.options.Enabled() {
+		return false
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	b, ok := d.backends[locator.BackendKey(target)]
+	return ok && d.isEjected(b, d.now())
+}
+
+// ejections returns the current ejections, by backend
+func (d *outlierDetector) ejections() map[string]*Ejection {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	now := d.now()
+	ejections := make(map[string]*Ejection)
+	for name, b := range d.backends {
+		if d.isEjected(b, now) {
+			ejections[name] = &Ejection{Until: b.ejectedUntil, Count: b.ejections, Reason: b.reason}
+		}
+	}
+	return ejections
+}
+
+// forget records the current selection, and discards the health of backends which are
+// neither selected nor ejected
+func (d *outlierDetector) forget(selection []*url.URL) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.selection = selection
+	now := d.now()
+	ejected := 0
+	for name, b := range d.backends {
+		if d.isEjected(b, now) {
+			ejected++
+		} else if !containsBackend(selection, name) {
+			delete(d.backends, name)
+		}
+	}
+	d.metrics.ejectedBackends.Set(float64(ejected))
+}
+
+// isEjected answers whether the backend is ejected at the provided time, restoring it
+// once its ejection has expired; the mutex must be held
+func (d *outlierDetector) isEjected(b *backendHealth, now time.Time) bool {
+	if b.ejected && !now.Before(b.ejectedUntil) {
+		b.ejected = false
+		log.Infof("Restoring backend %s, which was ejected for %s", b.name, b.reason)
+	}
+	return b.ejected
+}
+
+func containsBackend(a []*url.URL, name string) bool {
+	for _, v := range a {
+		if locator.BackendKey(v) == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package router
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+// testMetrics creates the metrics used by outlier detection and circuit breakers, without registering them
+func testMetrics() *metrics {
+	return &metrics{
+		outlierEjections:    prometheus.NewCounterVec(prometheus.CounterOpts{Name: "outlier_ejections"}, []string{"backend", "reason"}),
+		ejectedBackends:     prometheus.NewGauge(prometheus.GaugeOpts{Name: "ejected_backends"}),
+		circuitBreakerTrips: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "circuit_breaker_trips"}, []string{"backend"}),
+		circuitBreakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "circuit_breaker_state"}, []string{"backend"}),
+	}
+}
+
+// newTestDetector creates an outlier detector with unregistered metrics and a fake clock
+func newTestDetector(options OutlierDetection, now *time.Time) *outlierDetector {
+	d := newOutlierDetector(options, testMetrics())
+	d.now = func() time.Time { return *now }
+	return d
+}
+
+func TestOutlierEjection(t *testing.T) {
+	options := OutlierDetection{
+		Window:          10 * time.Second,
+		MinRequests:     4,
+		ErrorRatio:      0.5,
+		Latency:         time.Second,
+		EjectionTime:    30 * time.Second,
+		MaxEjectionTime: 45 * time.Second,
+		MaxEjectedRatio: 0.5,
+	}
+	now := time.Date(2017, 8, 7, 12, 0, 0, 0, time.UTC)
+	d := newTestDetector(options, &now)
+
+	var selection []*url.URL
+	for _, addr := range []string{"http://a:9090", "http://b:9090", "http://c:9090", "http://d:9090"} {
+		u, _ := url.Parse(addr)
+		selection = append(selection, u)
+	}
+	a, b, c, dd := selection[0], selection[1], selection[2], selection[3]
+	d.forget(selection)
+
+	// a backend returning errors is ejected once it has received enough requests
+	for _, status := range []int{http.StatusOK, http.StatusInternalServerError, http.StatusOK} {
+		d.record(a, status, time.Millisecond)
+	}
+	assert.False(t, d.ejected(a))
+	d.record(a, http.StatusServiceUnavailable, time.Millisecond)
+	assert.True(t, d.ejected(a))
+	assert.Equal(t, []*url.URL{b, c, dd}, d.available(selection))
+
+	// as is a slow backend
+	for i := 0; i < 4; i++ {
+		d.record(b, http.StatusOK, 2*time.Second)
+	}
+	assert.True(t, d.ejected(b))
+	ejections := d.ejections()
+	assert.Equal(t, 2, len(ejections))
+	assert.Equal(t, "error ratio 0.50 over 4 requests", ejections["http://a:9090"].Reason)
+	assert.Equal(t, "mean latency 2s over 4 requests", ejections["http://b:9090"].Reason)
+
+	// no more than half of the selection may be ejected
+	for i := 0; i < 4; i++ {
+		d.record(c, http.StatusBadGateway, time.Millisecond)
+	}
+	assert.False(t, d.ejected(c))
+	assert.Equal(t, []*url.URL{c, dd}, d.available(selection))
+
+	// responses outside of the window are not counted
+	for i := 0; i < 3; i++ {
+		d.record(dd, http.StatusInternalServerError, time.Millisecond)
+	}
+	now = now.Add(11 * time.Second)
+	d.record(dd, http.StatusOK, time.Millisecond)
+	assert.False(t, d.ejected(dd))
+
+	// ejected backends are restored after the ejection time, and the ejection time doubles for
+	// consecutive ejections, up to the maximum
+	now = now.Add(20 * time.Second)
+	assert.Equal(t, selection, d.available(selection))
+	for i := 0; i < 4; i++ {
+		d.record(a, http.StatusInternalServerError, time.Millisecond)
+	}
+	assert.Equal(t, 2, d.ejections()["http://a:9090"].Count)
+	assert.Equal(t, now.Add(45*time.Second), d.ejections()["http://a:9090"].Until)
+
+	// consecutive ejections are forgotten once the backend has been in service for the maximum ejection time
+	now = now.Add(45*time.Second + 45*time.Second)
+	for i := 0; i < 4; i++ {
+		d.record(a, http.StatusInternalServerError, time.Millisecond)
+	}
+	assert.Equal(t, 1, d.ejections()["http://a:9090"].Count)
+
+	// backends which are neither selected nor ejected are forgotten
+	d.forget(selection[:1])
+	assert.Equal(t, 1, len(d.backends))
+
+	assert.Nil(t, OutlierDetection{}.validate())
+	assert.NotNil(t, OutlierDetection{ErrorRatio: 0.5}.validate())
+	assert.NotNil(t, OutlierDetection{ErrorRatio: 0.5, Window: time.Minute, EjectionTime: time.Minute,
+		MaxEjectionTime: time.Second}.validate())
+}
@@ -3,7 +3,9 @@ package router
 import (
 	"context"
 	"net/http"
+	"net/url"
 
+	"github.com/matt-deboer/mpp/pkg/locator"
 	"github.com/prometheus/common/log"
 )
 
@@ -12,7 +14,8 @@ type contextKey int
 var retryKey contextKey
 
 type retry struct {
-	value bool
+	value  bool
+	target *url.URL
 }
 
 func retryOnNext(req *http.Request) {
@@ -21,6 +24,13 @@ func retryOnNext(req *http.Request) {
 	}
 }
 
+// retryTarget records the target to which the request was routed
+func retryTarget(req *http.Request, target *url.URL) {
+	if retry, ok := req.Context().Value(retryKey).(*retry); ok {
+		retry.target = target
+	}
+}
+
 func shouldRetry(req *http.Request) bool {
 	retry, ok := req.Context().Value(retryKey).(*retry)
 	return ok && retry.value
@@ -29,7 +39,9 @@ func shouldRetry(req *http.Request) bool {
 func handleRetry(req *http.Request, router *Router) {
 	if shouldRetry(req) {
 		log.Warnf("Backend selection forced by retry")
-		router.metrics.retriesByBackend.WithLabelValues(backend(req.URL)).Inc()
+		if retry, ok := req.Context().Value(retryKey).(*retry); ok && retry.target != nil {
+			router.metrics.retriesByBackend.WithLabelValues(locator.BackendKey(retry.target)).Inc()
+		}
 		router.doSelection()
 	} else {
 		retryOnNext(req)
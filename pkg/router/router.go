@@ -28,10 +28,14 @@ type Router struct {
 	affinityOptions []AffinityOption
 	interval        time.Duration
 	metrics         *metrics
+	outliers        *outlierDetector
+	breakers        *circuitBreakers
 	// used to mark control of the selection process
 	theConch            chan struct{}
 	selectionInProgress sync.RWMutex
 	shutdownHook        chan struct{}
+	// signals that a locator has reported a change to its endpoints
+	reselect chan struct{}
 }
 
 // Status contains a snapshot status summary of the router state
@@ -42,20 +46,41 @@ type Status struct {
 	AffinityOptions     string
 	ComparisonMetric    string
 	Interval            time.Duration
+	// Ejections contains the current outlier ejections, by endpoint address
+	Ejections map[string]*Ejection
+	// Circuits describes the circuit breakers which are not closed, by endpoint address
+	Circuits map[string]string
 }
 
-type urlRewriter func(u *url.URL)
+// urlRewriter rewrites the provided url to address a selected target, returning that target
+type urlRewriter func(u *url.URL) *url.URL
 
-var noOpRewriter = func(u *url.URL) {}
+// changeSettleTime is the period of quiet awaited after a locator reports changes,
+// so that bursts of changes result in a single selection
+const changeSettleTime = 250 * time.Millisecond
 
-// NewRouter constructs a new router based on the provided stategy and locators
-func NewRouter(interval time.Duration, affinityOptions []AffinityOption,
-	locators []locator.Locator, strategyArgs ...string) (*Router, error) {
+var noOpRewriter = func(u *url.URL) *url.URL { return nil }
 
+// NewRouter constructs a new router based on the provided stategy and locators; stability
+// configures hysteresis for strategies which select a single endpoint, outlierDetection
+// configures the ejection of selected backends whose responses are failing or slow, and
+// circuitBreaker configures the circuit breaker of each backend
+func NewRouter(interval time.Duration, affinityOptions []AffinityOption, stability selector.Stability,
+	outlierDetection OutlierDetection, circuitBreaker CircuitBreaker, locators []locator.Locator,
+	strategyArgs ...string) (*Router, error) {
+
+	if err := outlierDetection.validate(); err != nil {
+		return nil, err
+	}
+	if err := circuitBreaker.validate(); err != nil {
+		return nil, err
+	}
 	sel, err := selector.NewSelector(locators, strategyArgs...)
 	if err != nil {
 		return nil, err
 	}
+	sel.Stability = stability
+	m := newMetrics(version.Name)
 
 	r := &Router{
 		locators:        locators,
@@ -63,28 +88,43 @@ func NewRouter(interval time.Duration, affinityOptions []AffinityOption,
 		affinityOptions: affinityOptions,
 		interval:        interval,
 		rewriter:        noOpRewriter,
-		metrics:         newMetrics(version.Name),
+		metrics:         m,
+		outliers:        newOutlierDetector(outlierDetection, m),
+		breakers:        newCircuitBreakers(circuitBreaker, m),
 		selection:       &selector.Result{},
 		theConch:        make(chan struct{}, 1),
 		shutdownHook:    make(chan struct{}, 1),
+		reselect:        make(chan struct{}, 1),
 	}
 
 	// Set up the lock
 	r.theConch <- struct{}{}
 	r.doSelection()
+	for _, loc := range locators {
+		if notifier, ok := loc.(locator.ChangeNotifier); ok {
+			go r.watchForChanges(loc, notifier)
+		}
+	}
 	go func() {
-		// TODO: create shutdown channel for this
+		timer := time.NewTimer(r.interval)
+		defer timer.Stop()
 		for {
 			if log.GetLevel() >= log.DebugLevel {
 				log.Debugf("Backend selection is sleeping for %s", interval)
 			}
-			time.Sleep(r.interval)
 
 			select {
 			case _ = <-r.shutdownHook:
 				return
-			default:
+			case _ = <-r.reselect:
+				r.awaitSettledChanges()
+				log.Infof("Backend selection triggered by locator changes")
+				r.doSelection()
+				// the interval restarts from the triggered selection
+				resetTimer(timer, r.interval)
+			case _ = <-timer.C:
 				r.doSelection()
+				timer.Reset(r.interval)
 			}
 		}
 	}()
@@ -103,6 +143,45 @@ func (r *Router) Close() {
 	r.shutdownHook <- struct{}{}
 }
 
+// watchForChanges requests a new selection whenever the notifier reports a change
+func (r *Router) watchForChanges(loc locator.Locator, notifier locator.ChangeNotifier) {
+	for _ = range notifier.Changes() {
+		if log.GetLevel() >= log.DebugLevel {
+			log.Debugf("Locator %v reported changed endpoints", loc)
+		}
+		select {
+		case r.reselect <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// awaitSettledChanges waits until no further changes have been reported
+// for the duration of changeSettleTime
+func (r *Router) awaitSettledChanges() {
+	timer := time.NewTimer(changeSettleTime)
+	defer timer.Stop()
+	for {
+		select {
+		case _ = <-r.reselect:
+			resetTimer(timer, changeSettleTime)
+		case _ = <-timer.C:
+			return
+		}
+	}
+}
+
+// resetTimer restarts the timer for the provided duration, discarding any pending expiry
+func resetTimer(timer *time.Timer, d time.Duration) {
+	if !timer.Stop() {
+		select {
+		case _ = <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(d)
+}
+
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	r.buffer.ServeHTTP(w, retryableRequest(req))
 }
@@ -142,20 +221,23 @@ func (r *Router) doSelection() {
 				log.Debugf("Selected targets: %v", result.Selection)
 			}
 			if r.selection == nil || !equal(r.selection.Selection, result.Selection) {
-				log.Infof("New targets differ from current selection %v; updating rewriter => %v", r.selection, result)
-				r.rewriter = func(u *url.URL) {
-					selection := result.Selection
+				log.Infof("New targets differ from current selection %v; updating rewriter => %v (%s)", r.selection, result, result.Reason)
+				r.metrics.selectionChanges.WithLabelValues(result.Reason).Inc()
+				r.rewriter = func(u *url.URL) *url.URL {
+					selection := r.available(result.Selection)
 					i := r.selector.Strategy.NextIndex(selection)
 					target := selection[i]
-					u.Host = target.Host
-					u.Scheme = target.Scheme
+					rewrite(u, target)
+					return target
 				}
 			} else {
-				log.Infof("Selection is unchanged: %v, out of candidates: %v", r.selection.Selection, r.selection.Candidates)
+				log.Infof("Selection is unchanged (%s): %v, out of candidates: %v", result.Reason, r.selection.Selection, r.selection.Candidates)
 			}
 			r.selection = result
 		}
 
+		r.outliers.forget(r.selection.Selection)
+		r.breakers.forget(r.selection.Selection, r.selection.Candidates)
 		r.metrics.selectedBackends.Set(float64(len(result.Selection)))
 		r.metrics.selectionEvents.Inc()
 
@@ -166,6 +248,17 @@ func (r *Router) doSelection() {
 	}
 }
 
+// available returns the targets of the selection which are neither ejected as outliers, nor
+// stopped by their circuit breakers
+func (r *Router) available(selection []*url.URL) []*url.URL {
+	return r.breakers.available(r.outliers.available(selection))
+}
+
+// routable answers whether requests may be routed to the target, such as by session affinity
+func (r *Router) routable(target *url.URL) bool {
+	return !r.outliers.ejected(target) && r.breakers.permitted(target)
+}
+
 func equal(a, b []*url.URL) bool {
 	if len(a) == len(b) {
 		for i, v := range a {
@@ -187,12 +280,31 @@ func contains(a []*url.URL, u *url.URL) bool {
 	return false
 }
 
-func backend(u *url.URL) string {
-	return fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+// rewrite updates the provided url to address the target, prefixing
+// its path with the path of the target (if any)
+func rewrite(u *url.URL, target *url.URL) {
+	u.Scheme = target.Scheme
+	u.Host = target.Host
+	if len(target.Path) > 0 {
+		u.Path = strings.TrimRight(target.Path, "/") + "/" + strings.TrimLeft(u.Path, "/")
+	}
 }
 
 // Status returns a summary of the router's current state
 func (r *Router) Status() *Status {
+	ejections := make(map[string]*Ejection)
+	circuits := make(map[string]string)
+	ejectionsByBackend, circuitsByBackend := r.outliers.ejections(), r.breakers.states()
+	for _, endpoint := range r.selection.Candidates {
+		if target, err := url.ParseRequestURI(endpoint.Address); err == nil {
+			if ejection, ok := ejectionsByBackend[locator.BackendKey(target)]; ok {
+				ejections[endpoint.Address] = ejection
+			}
+			if state, ok := circuitsByBackend[locator.BackendKey(target)]; ok {
+				circuits[endpoint.Address] = state
+			}
+		}
+	}
 	return &Status{
 		Endpoints:           r.selection.Candidates,
 		Strategy:            r.selector.Strategy.Name(),
@@ -200,5 +312,7 @@ func (r *Router) Status() *Status {
 		ComparisonMetric:    r.selector.Strategy.ComparisonMetricName(),
 		AffinityOptions:     strings.Trim(fmt.Sprintf("%v", r.affinityOptions), "[]"),
 		Interval:            r.interval,
+		Ejections:           ejections,
+		Circuits:            circuits,
 	}
 }
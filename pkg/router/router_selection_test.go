@@ -13,6 +13,7 @@ import (
 
 	"github.com/matt-deboer/mpp/pkg/locator"
 	"github.com/matt-deboer/mpp/pkg/router"
+	"github.com/matt-deboer/mpp/pkg/selector"
 	_ "github.com/matt-deboer/mpp/pkg/selector/strategy/random"
 )
 
@@ -108,7 +109,8 @@ func TestServeHTTPUnderLoadWithFailuresAndReselection(t *testing.T) {
 	}
 
 	// router performs background selection 4 times per second
-	r, err := router.NewRouter(250*time.Millisecond, []router.AffinityOption{*ao1, *ao2}, []locator.Locator{ml}, "random")
+	r, err := router.NewRouter(250*time.Millisecond, []router.AffinityOption{*ao1, *ao2}, selector.Stability{},
+		router.OutlierDetection{}, router.CircuitBreaker{}, []locator.Locator{ml}, "random")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,39 @@
+package router
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteWithPathPrefix(t *testing.T) {
+	target, _ := url.Parse("https://10.0.0.1:9090/prometheus")
+	u, _ := url.Parse("/api/v1/query?query=up")
+
+	rewrite(u, target)
+	assert.Equal(t, "https://10.0.0.1:9090/prometheus/api/v1/query?query=up", u.String())
+	assert.Equal(t, "https://10.0.0.1:9090/prometheus", locator.BackendKey(target))
+}
+
+func TestRewriteWithoutPath(t *testing.T) {
+	target, _ := url.Parse("http://10.0.0.1:9090")
+	u, _ := url.Parse("/api/v1/query?query=up")
+
+	rewrite(u, target)
+	assert.Equal(t, "http://10.0.0.1:9090/api/v1/query?query=up", u.String())
+	assert.Equal(t, "http://10.0.0.1:9090", locator.BackendKey(target))
+}
+
+func TestResetTimerDiscardsPendingExpiry(t *testing.T) {
+	timer := time.NewTimer(time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	resetTimer(timer, time.Hour)
+	select {
+	case <-timer.C:
+		assert.Fail(t, "Expected the pending expiry to be discarded")
+	default:
+	}
+}
@@ -0,0 +1,46 @@
+package router
+
+import "time"
+
+// windowBuckets is the number of buckets into which a sliding window is divided
+const windowBuckets = 10
+
+type windowBucket struct {
+	start    time.Time
+	requests int
+	errors   int
+	latency  time.Duration
+}
+
+// slidingWindow counts the requests to a backend, and their errors and latency, over a sliding
+// window which advances one bucket (a tenth of the window) at a time
+type slidingWindow struct {
+	buckets [windowBuckets]windowBucket
+}
+
+// add accounts for a request completed at the provided time
+func (w *slidingWindow) add(now time.Time, window time.Duration, failed bool, elapsed time.Duration) {
+	width := window / windowBuckets
+	start := now.Truncate(width)
+	bucket := &w.buckets[(start.UnixNano()/int64(width))%windowBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = windowBucket{start: start}
+	}
+	bucket.requests++
+	if failed {
+		bucket.errors++
+	}
+	bucket.latency += elapsed
+}
+
+// totals sums the requests, errors and latency within the window ending at the provided time
+func (w *slidingWindow) totals(now time.Time, window time.Duration) (requests, errors int, latency time.Duration) {
+	for _, bucket := range w.buckets {
+		if now.Sub(bucket.start) < window {
+			requests += bucket.requests
+			errors += bucket.errors
+			latency += bucket.latency
+		}
+	}
+	return requests, errors, latency
+}
@@ -0,0 +1,163 @@
+package selector
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	log "github.com/sirupsen/logrus"
+)
+
+const chainPrefix = "chain("
+
+// Chain is a composite strategy which applies a sequence of strategies, each of which
+// chooses from the endpoints selected by the previous one; the last strategy determines
+// how requests are distributed amongst the final selection
+type Chain struct {
+	stages []Strategy
+}
+
+// NewChain creates a composite strategy from a specification of the form
+// 'chain({strategy}[:{args}],{strategy}[:{args}],...)'
+func NewChain(spec string) (*Chain, error) {
+	if !strings.HasPrefix(spec, chainPrefix) || !strings.HasSuffix(spec, ")") {
+		return nil, fmt.Errorf("Invalid chain strategy '%s'; expected chain({strategy},{strategy},...)", spec)
+	}
+	c := &Chain{}
+	for _, stage := range splitStages(spec[len(chainPrefix) : len(spec)-1]) {
+		stage = strings.TrimSpace(stage)
+		if len(stage) == 0 {
+			return nil, fmt.Errorf("Invalid chain strategy '%s'; empty stage", spec)
+		}
+		if strings.HasPrefix(stage, chainPrefix) {
+			return nil, fmt.Errorf("Invalid chain strategy '%s'; chains may not be nested", spec)
+		}
+		strategy, err := newStrategy(strings.Split(stage, ":")...)
+		if err != nil {
+			return nil, err
+		}
+		c.stages = append(c.stages, strategy)
+	}
+	if len(c.stages) == 0 {
+		return nil, fmt.Errorf("Invalid chain strategy '%s'; at least one stage is required", spec)
+	}
+	return c, nil
+}
+
+// splitStages splits on commas which are not enclosed by parentheses, braces, brackets or
+// quotes, such that stages may contain PromQL expressions
+func splitStages(s string) []string {
+	var stages []string
+	depth, start := 0, 0
+	var quote rune
+	for i, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '{' || c == '[':
+			depth++
+		case c == ')' || c == '}' || c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			stages = append(stages, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(stages, s[start:])
+}
+
+// Name provides the (unique) name of this strategy
+func (c *Chain) Name() string {
+	names := make([]string, len(c.stages))
+	for i, stage := range c.stages {
+		names[i] = stage.Name()
+	}
+	return chainPrefix + strings.Join(names, ",") + ")"
+}
+
+// Description provides a human-readable description for this strategy
+func (c *Chain) Description() string {
+	descriptions := make([]string, len(c.stages))
+	for i, stage := range c.stages {
+		descriptions[i] = stage.Description()
+	}
+	return strings.Join(descriptions, "; then ")
+}
+
+// ComparisonMetricName gets the name of the comparison metric/calculation used to make a selection;
+// the metric used for each endpoint is that of the last stage which evaluated it
+func (c *Chain) ComparisonMetricName() string {
+	return "(by stage)"
+}
+
+// RequiresStickySessions answers whether this strategy needs sticky sessions
+func (c *Chain) RequiresStickySessions() bool {
+	if sticky, ok := c.stages[len(c.stages)-1].(interface {
+		RequiresStickySessions() bool
+	}); ok {
+		return sticky.RequiresStickySessions()
+	}
+	return false
+}
+
+// NextIndex returns the index of the target that should be used to field the next request
+func (c *Chain) NextIndex(targets []*url.URL) int {
+	return c.stages[len(c.stages)-1].NextIndex(targets)
+}
+
+// RequestStarted passes the request to the last stage, if it is an Observer
+func (c *Chain) RequestStarted(target *url.URL) {
+	if observer, ok := c.stages[len(c.stages)-1].(Observer); ok {
+		observer.RequestStarted(target)
+	}
+}
+
+// RequestCompleted passes the request to the last stage, if it is an Observer
+func (c *Chain) RequestCompleted(target *url.URL, duration time.Duration) {
+	if observer, ok := c.stages[len(c.stages)-1].(Observer); ok {
+		observer.RequestCompleted(target, duration)
+	}
+}
+
+// Select chooses elligible prometheus endpoints out of the provided set, by applying each stage
+// to the endpoints selected by the previous stage; endpoints which are not selected by a stage are
+// marked as having been eliminated by it, at its position in the chain
+func (c *Chain) Select(endpoints []*locator.PrometheusEndpoint) (err error) {
+	for _, endpoint := range endpoints {
+		endpoint.EliminatedBy, endpoint.EliminatedAt = "", 0
+	}
+	candidates := endpoints
+	for i, stage := range c.stages {
+		for _, endpoint := range candidates {
+			endpoint.ComparisonMetricName = ""
+			endpoint.ComparisonMetricValue = nil
+		}
+		err = stage.Select(candidates)
+		survivors := make([]*locator.PrometheusEndpoint, 0, len(candidates))
+		for _, endpoint := range candidates {
+			if len(endpoint.ComparisonMetricName) == 0 && endpoint.ComparisonMetricValue != nil {
+				endpoint.ComparisonMetricName = stage.ComparisonMetricName()
+			}
+			if endpoint.Selected && err == nil {
+				survivors = append(survivors, endpoint)
+			} else {
+				endpoint.Selected = false
+				endpoint.EliminatedBy, endpoint.EliminatedAt = stage.Name(), i+1
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("Stage %s of %s failed: %v", stage.Name(), c.Name(), err)
+		}
+		if log.GetLevel() >= log.DebugLevel {
+			log.Debugf("Stage %s of %s selected: %v", stage.Name(), c.Name(), survivors)
+		}
+		candidates = survivors
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package selector
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/stretchr/testify/assert"
+)
+
+// labelStrategy selects the endpoints having the label named by its first argument
+type labelStrategy struct {
+	label string
+}
+
+func (s *labelStrategy) Name() string                     { return "label:" + s.label }
+func (s *labelStrategy) Description() string              { return "Selects endpoints labeled " + s.label }
+func (s *labelStrategy) ComparisonMetricName() string     { return s.label }
+func (s *labelStrategy) NextIndex(targets []*url.URL) int { return len(targets) - 1 }
+func (s *labelStrategy) Select(endpoints []*locator.PrometheusEndpoint) error {
+	selected := 0
+	for _, endpoint := range endpoints {
+		endpoint.ComparisonMetricValue = endpoint.Labels[s.label]
+		endpoint.Selected = len(endpoint.Labels[s.label]) > 0
+		if endpoint.Selected {
+			selected++
+		}
+	}
+	if selected == 0 {
+		return fmt.Errorf("No endpoints labeled %s", s.label)
+	}
+	return nil
+}
+
+func init() {
+	RegisterStrategy("label", func(args ...string) (Strategy, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("Strategy label requires a {label} argument")
+		}
+		return &labelStrategy{label: args[0]}, nil
+	})
+}
+
+func TestSplitStages(t *testing.T) {
+	assert.Equal(t, []string{"minimum-history:24h", "expression:max:count(sum by (a,b) (up{c=~\"d,e\"}))", "random"},
+		splitStages(`minimum-history:24h,expression:max:count(sum by (a,b) (up{c=~"d,e"})),random`))
+}
+
+func TestChain(t *testing.T) {
+	// the strategy flag is split on ':' before reaching the selector
+	s, err := NewSelector(nil, "chain(label", "a,label", "b)")
+	assert.Nil(t, err)
+	assert.Equal(t, "chain(label:a,label:b)", s.Strategy.Name())
+
+	endpoints := []*locator.PrometheusEndpoint{
+		{Address: "http://1", Labels: map[string]string{"a": "x"}},
+		{Address: "http://2", Labels: map[string]string{"a": "x", "b": "y"}},
+		{Address: "http://3", Labels: map[string]string{"b": "y"}},
+	}
+	assert.Nil(t, s.Strategy.Select(endpoints))
+	assert.Equal(t, []bool{false, true, false}, []bool{endpoints[0].Selected, endpoints[1].Selected, endpoints[2].Selected})
+	assert.Equal(t, "label:b", endpoints[0].EliminatedBy)
+	assert.Equal(t, "", endpoints[1].EliminatedBy)
+	assert.Equal(t, "label:a", endpoints[2].EliminatedBy)
+	assert.Equal(t, []int{2, 0, 1}, []int{endpoints[0].EliminatedAt, endpoints[1].EliminatedAt, endpoints[2].EliminatedAt})
+	assert.Equal(t, "b", endpoints[1].ComparisonMetricName)
+	assert.Equal(t, 0, s.Strategy.NextIndex([]*url.URL{{}}))
+
+	s, err = NewSelector(nil, "chain(label", "c,label", "a)")
+	assert.Nil(t, err)
+	assert.NotNil(t, s.Strategy.Select(endpoints))
+	for _, endpoint := range endpoints {
+		assert.False(t, endpoint.Selected)
+		assert.Equal(t, "label:c", endpoint.EliminatedBy)
+	}
+
+	// repeated strategies are distinguished by their position
+	s, err = NewSelector(nil, "chain(label", "a,label", "a,label", "b)")
+	assert.Nil(t, err)
+	assert.Nil(t, s.Strategy.Select(endpoints))
+	assert.Equal(t, []int{3, 0, 1}, []int{endpoints[0].EliminatedAt, endpoints[1].EliminatedAt, endpoints[2].EliminatedAt})
+
+	for _, spec := range []string{"chain()", "chain(label:a,)", "chain(label:a", "chain(unknown)", "chain(chain(label:a))"} {
+		_, err = NewSelector(nil, spec)
+		assert.NotNil(t, err, "Expected an error for %s", spec)
+	}
+}
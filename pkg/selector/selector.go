@@ -3,9 +3,12 @@ package selector
 import (
 	"fmt"
 	"net/url"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/matt-deboer/mpp/pkg/locator"
+	metrics "github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -13,31 +16,52 @@ import (
 type Selector struct {
 	locators []locator.Locator
 	Strategy Strategy
+	// Stability optionally prevents flapping between single-endpoint selections
+	Stability Stability
+	state     stabilityState
 }
 
 // Result encapsulates a selection result, including the candidate endpoints considered
 type Result struct {
 	Selection  []*url.URL
 	Candidates []*locator.PrometheusEndpoint
+	// Reason describes the outcome of the selection, as one of the Reason* constants
+	Reason string
 }
 
 func (r *Result) String() string {
 	return fmt.Sprintf("%v", r.Selection)
 }
 
-// NewSelector returns a new Selector instance of the specified type
+// NewSelector returns a new Selector instance of the specified type; a composite strategy
+// may be specified as 'chain({strategy},{strategy},...)'
 func NewSelector(locators []locator.Locator, strategyArgs ...string) (*Selector, error) {
 	if len(strategyArgs) == 0 {
 		return nil, fmt.Errorf("At minimum, a strategy name (first arg) must be provided")
 	}
-	if stratgyFactory, ok := strategies[strategyArgs[0]]; ok {
-		strategy, err := stratgyFactory(strategyArgs[1:]...)
+	if strings.HasPrefix(strategyArgs[0], chainPrefix) {
+		chain, err := NewChain(strings.Join(strategyArgs, ":"))
 		if err != nil {
 			return nil, err
 		}
-		return &Selector{locators: locators, Strategy: strategy}, nil
+		return &Selector{locators: locators, Strategy: chain}, nil
 	}
-	return nil, fmt.Errorf("No selector strategy named '%s' found", strategyArgs[0])
+	strategy, err := newStrategy(strategyArgs...)
+	if err != nil {
+		return nil, err
+	}
+	return &Selector{locators: locators, Strategy: strategy}, nil
+}
+
+// newStrategy creates the registered strategy named by the first arg, passing the remaining args
+func newStrategy(strategyArgs ...string) (Strategy, error) {
+	strategyMutex.Lock()
+	stratgyFactory, ok := strategies[strategyArgs[0]]
+	strategyMutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("No selector strategy named '%s' found", strategyArgs[0])
+	}
+	return stratgyFactory(strategyArgs[1:]...)
 }
 
 // Select performs selection of a/all viable prometheus endpoint target(s)
@@ -72,6 +96,7 @@ func (s *Selector) Select() (result *Result, err error) {
 	if err != nil {
 		return result, err
 	}
+	result.Reason = s.stabilize(result.Candidates)
 
 	result.Selection = make([]*url.URL, 0, len(result.Candidates))
 	for _, endpoint := range result.Candidates {
@@ -103,6 +128,15 @@ type Strategy interface {
 	NextIndex(targets []*url.URL) int
 }
 
+// Observer is an optional interface for strategies which make use of the requests
+// forwarded to the selected targets (e.g., to balance load by response latency)
+type Observer interface {
+	// RequestStarted is called as a request is forwarded to the target
+	RequestStarted(target *url.URL)
+	// RequestCompleted is called once a request forwarded to the target has completed
+	RequestCompleted(target *url.URL, duration time.Duration)
+}
+
 // All registered platforms
 var (
 	strategyMutex sync.Mutex
@@ -118,3 +152,15 @@ func RegisterStrategy(name string, factory func(args ...string) (Strategy, error
 		log.Debugf("Registered strategy '%s'", name)
 	}
 }
+
+// RegisterMetric registers the collector of a strategy's metrics, returning the existing collector
+// if one was already registered (i.e., when the strategy is created more than once)
+func RegisterMetric(c metrics.Collector) metrics.Collector {
+	if err := metrics.Register(c); err != nil {
+		if are, ok := err.(metrics.AlreadyRegisteredError); ok {
+			return are.ExistingCollector
+		}
+		log.Errorf("Failed to register metrics: %v", err)
+	}
+	return c
+}
@@ -0,0 +1,145 @@
+package selector
+
+import (
+	"math"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	log "github.com/sirupsen/logrus"
+)
+
+// Reasons for the outcome of a selection, reported in Result.Reason
+const (
+	// ReasonInitial indicates the first selection of a single endpoint
+	ReasonInitial = "initial"
+	// ReasonUnchanged indicates that the strategy selected the current endpoint(s)
+	ReasonUnchanged = "unchanged"
+	// ReasonChanged indicates a change of selection to which stability was not applied
+	ReasonChanged = "changed"
+	// ReasonIncumbentIneligible indicates a change away from an endpoint which is no longer eligible
+	ReasonIncumbentIneligible = "incumbent-ineligible"
+	// ReasonMarginExceeded indicates a change to an endpoint which beat the current one by the margin
+	ReasonMarginExceeded = "margin-exceeded"
+	// ReasonRoundsExceeded indicates a change to an endpoint which beat the current one for the required rounds
+	ReasonRoundsExceeded = "rounds-exceeded"
+	// ReasonHeld indicates that the current endpoint was retained in favor of the endpoint chosen by the strategy
+	ReasonHeld = "held"
+)
+
+// Stability configures hysteresis for single-endpoint selections: the currently selected endpoint is
+// retained unless the endpoint chosen by the strategy (the challenger) beats it by more than Margin
+// (a ratio of the current endpoint's comparison metric value), or is chosen for Rounds consecutive
+// selections; either may be zero to disable it
+type Stability struct {
+	Margin float64
+	Rounds int
+}
+
+func (st Stability) enabled() bool {
+	return st.Margin > 0 || st.Rounds > 0
+}
+
+// stabilityState tracks the current selection and challenger across selection rounds
+type stabilityState struct {
+	incumbent        string
+	challenger       string
+	challengerRounds int
+}
+
+// stabilize applies the configured stability to the endpoints selected by the strategy, re-selecting
+// the incumbent endpoint where the challenger does not yet warrant a change; the reason for the
+// outcome is returned
+func (s *Selector) stabilize(endpoints []*locator.PrometheusEndpoint) string {
+	var selected []*locator.PrometheusEndpoint
+	var incumbent *locator.PrometheusEndpoint
+	for _, endpoint := range endpoints {
+		if endpoint.Selected {
+			selected = append(selected, endpoint)
+		}
+		if endpoint.Address == s.state.incumbent {
+			incumbent = endpoint
+		}
+	}
+	if len(selected) != 1 {
+		s.state = stabilityState{}
+		return ReasonChanged
+	}
+
+	challenger := selected[0]
+	if challenger.Address == s.state.incumbent {
+		s.state.challenger, s.state.challengerRounds = "", 0
+		return ReasonUnchanged
+	}
+
+	reason := ReasonChanged
+	switch {
+	case len(s.state.incumbent) == 0:
+		reason = ReasonInitial
+	case !s.Stability.enabled():
+	case incumbent == nil || !s.eligible(incumbent):
+		reason = ReasonIncumbentIneligible
+	default:
+		if challenger.Address == s.state.challenger {
+			s.state.challengerRounds++
+		} else {
+			s.state.challenger, s.state.challengerRounds = challenger.Address, 1
+		}
+		exceeded, comparable := exceedsMargin(challenger, incumbent, s.Stability.Margin)
+		switch {
+		case s.Stability.Margin > 0 && exceeded:
+			reason = ReasonMarginExceeded
+		case s.Stability.Rounds > 0 && s.state.challengerRounds >= s.Stability.Rounds:
+			reason = ReasonRoundsExceeded
+		case s.Stability.Rounds == 0 && !comparable:
+			log.Warnf("Unable to compare the values of %v and %v; stability margin is not applied", challenger, incumbent)
+		default:
+			log.Infof("Retaining current selection %v over %v (%v vs. %v; round %d)", incumbent, challenger,
+				incumbent.ComparisonMetricValue, challenger.ComparisonMetricValue, s.state.challengerRounds)
+			challenger.Selected = false
+			incumbent.Selected = true
+			incumbent.EliminatedBy, incumbent.EliminatedAt = "", 0
+			return ReasonHeld
+		}
+	}
+	s.state = stabilityState{incumbent: challenger.Address}
+	return reason
+}
+
+// eligible returns true if the endpoint could have been chosen by the strategy, having lost only on rank
+func (s *Selector) eligible(endpoint *locator.PrometheusEndpoint) bool {
+	if endpoint.Error != nil || endpoint.QueryAPI == nil || !endpoint.Ready() {
+		return false
+	}
+	if endpoint.EliminatedAt > 0 {
+		chain, ok := s.Strategy.(*Chain)
+		if !ok || endpoint.EliminatedAt != len(chain.stages) {
+			return false
+		}
+	}
+	return endpoint.Viable()
+}
+
+// exceedsMargin returns true if the challenger's comparison metric value differs from the incumbent's
+// by more than the margin (relative to the incumbent's value), along with whether the values were comparable
+func exceedsMargin(challenger, incumbent *locator.PrometheusEndpoint, margin float64) (exceeded bool, comparable bool) {
+	c, ok := numeric(challenger.ComparisonMetricValue)
+	if !ok {
+		return false, false
+	}
+	i, ok := numeric(incumbent.ComparisonMetricValue)
+	if !ok {
+		return false, false
+	}
+	return math.Abs(c-i) > margin*math.Abs(i), true
+}
+
+func numeric(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case float64:
+		return v, !math.IsNaN(v)
+	}
+	return 0, false
+}
@@ -0,0 +1,128 @@
+package selector
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/prometheus/client_golang/api/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// mostValueStrategy selects the single endpoint with the highest value of the 'v' label
+type mostValueStrategy struct{}
+
+func (s *mostValueStrategy) Name() string                     { return "most-value" }
+func (s *mostValueStrategy) Description() string              { return "Selects the endpoint with the most value" }
+func (s *mostValueStrategy) ComparisonMetricName() string     { return "v" }
+func (s *mostValueStrategy) NextIndex(targets []*url.URL) int { return 0 }
+func (s *mostValueStrategy) Select(endpoints []*locator.PrometheusEndpoint) error {
+	var best *locator.PrometheusEndpoint
+	for _, endpoint := range endpoints {
+		endpoint.Selected = false
+		v, _ := strconv.ParseInt(endpoint.Labels["v"], 10, 64)
+		endpoint.ComparisonMetricValue = v
+		if best == nil || v > best.ComparisonMetricValue.(int64) {
+			best = endpoint
+		}
+	}
+	if best == nil {
+		return fmt.Errorf("No endpoints")
+	}
+	best.Selected = true
+	return nil
+}
+
+type okQueryAPI struct{}
+
+func (q okQueryAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, error) {
+	return model.Vector{}, nil
+}
+
+func (q okQueryAPI) QueryRange(ctx context.Context, query string, r prometheus.Range) (model.Value, error) {
+	return model.Matrix{}, nil
+}
+
+type valuesLocator struct {
+	values map[string]string
+}
+
+func (l *valuesLocator) Endpoints() ([]*locator.PrometheusEndpoint, error) {
+	var endpoints []*locator.PrometheusEndpoint
+	for _, addr := range []string{"http://a", "http://b", "http://c"} {
+		if v, ok := l.values[addr]; ok {
+			endpoints = append(endpoints, &locator.PrometheusEndpoint{
+				Address:  addr,
+				QueryAPI: okQueryAPI{},
+				Labels:   map[string]string{"v": v},
+			})
+		}
+	}
+	return endpoints, nil
+}
+
+func init() {
+	RegisterStrategy("most-value", func(args ...string) (Strategy, error) {
+		return &mostValueStrategy{}, nil
+	})
+}
+
+func TestStability(t *testing.T) {
+	loc := &valuesLocator{}
+	s, err := NewSelector([]locator.Locator{loc}, "most-value")
+	assert.Nil(t, err)
+	s.Stability = Stability{Margin: 0.1, Rounds: 3}
+
+	round := func(values map[string]string) (string, string) {
+		loc.values = values
+		result, err := s.Select()
+		assert.Nil(t, err)
+		assert.Len(t, result.Selection, 1)
+		return fmt.Sprintf("%s://%s", result.Selection[0].Scheme, result.Selection[0].Host), result.Reason
+	}
+
+	assertRound := func(values map[string]string, selection, reason string) {
+		sel, r := round(values)
+		assert.Equal(t, selection, sel)
+		assert.Equal(t, reason, r)
+	}
+
+	assertRound(map[string]string{"http://a": "100", "http://b": "99"}, "http://a", ReasonInitial)
+	assertRound(map[string]string{"http://a": "100", "http://b": "105"}, "http://a", ReasonHeld)
+	assertRound(map[string]string{"http://a": "100", "http://b": "101"}, "http://a", ReasonHeld)
+	// a different challenger restarts the rounds
+	assertRound(map[string]string{"http://a": "100", "http://b": "99", "http://c": "101"}, "http://a", ReasonHeld)
+	assertRound(map[string]string{"http://a": "100", "http://b": "101"}, "http://a", ReasonHeld)
+	assertRound(map[string]string{"http://a": "100", "http://b": "101"}, "http://a", ReasonHeld)
+	assertRound(map[string]string{"http://a": "100", "http://b": "101"}, "http://b", ReasonRoundsExceeded)
+	assertRound(map[string]string{"http://a": "100", "http://b": "101"}, "http://b", ReasonUnchanged)
+	assertRound(map[string]string{"http://a": "112", "http://b": "101"}, "http://a", ReasonMarginExceeded)
+	assertRound(map[string]string{"http://b": "101", "http://c": "99"}, "http://b", ReasonIncumbentIneligible)
+
+	s.Stability = Stability{}
+	assertRound(map[string]string{"http://b": "101", "http://c": "102"}, "http://c", ReasonChanged)
+}
+
+func TestStabilityWithRepeatedStrategies(t *testing.T) {
+	loc := &valuesLocator{}
+	s, err := NewSelector([]locator.Locator{loc}, "chain(most-value,most-value)")
+	assert.Nil(t, err)
+	s.Stability = Stability{Margin: 0.1}
+
+	loc.values = map[string]string{"http://a": "100", "http://b": "99"}
+	result, err := s.Select()
+	assert.Nil(t, err)
+	assert.Equal(t, ReasonInitial, result.Reason)
+
+	// the incumbent was eliminated by the first stage, rather than the last stage of the same name
+	loc.values = map[string]string{"http://a": "100", "http://b": "105"}
+	result, err = s.Select()
+	assert.Nil(t, err)
+	assert.Equal(t, ReasonIncumbentIneligible, result.Reason)
+	assert.Equal(t, "b", result.Selection[0].Host)
+}
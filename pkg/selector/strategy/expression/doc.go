@@ -0,0 +1,3 @@
+// Package expression implements target selection for multi-prometheus deployments
+// by ranking instances according to the result of an arbitrary PromQL expression
+package expression // import "github.com/matt-deboer/mpp/pkg/selector/strategy/expression"
@@ -0,0 +1,187 @@
+package expression
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/matt-deboer/mpp/pkg/selector"
+	"github.com/prometheus/common/model"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	baseName     = "expression"
+	queryTimeout = 10 * time.Second
+)
+
+// Possible directions
+const (
+	// Max selects the single endpoint with the highest result
+	Max = "max"
+	// Min selects the single endpoint with the lowest result
+	Min = "min"
+	// Threshold selects all endpoints with a result at or above the threshold value
+	Threshold = "threshold"
+)
+
+func init() {
+	rand.Seed(time.Now().UTC().UnixNano())
+	selector.RegisterStrategy(baseName, func(args ...string) (selector.Strategy, error) {
+		return NewSelector(args...)
+	})
+}
+
+// Selector implements selection of prometheus endpoints out of a provided set of endpoints,
+// ranked by the result of a PromQL expression evaluated on each of them
+type Selector struct {
+	direction  string
+	threshold  float64
+	expression string
+}
+
+// NewSelector creates an expression strategy from the arguments '{max|min}:{expression}'
+// or 'threshold:{value}:{expression}'; the expression may itself contain ':'
+func NewSelector(args ...string) (*Selector, error) {
+	usage := fmt.Errorf("Strategy %s requires arguments {max|min}:{expression} or threshold:{value}:{expression}", baseName)
+	if len(args) < 2 {
+		return nil, usage
+	}
+	s := &Selector{direction: args[0]}
+	switch s.direction {
+	case Max, Min:
+		s.expression = strings.Join(args[1:], ":")
+	case Threshold:
+		if len(args) < 3 {
+			return nil, usage
+		}
+		threshold, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid threshold value '%s' for %s: %v", args[1], baseName, err)
+		}
+		s.threshold = threshold
+		s.expression = strings.Join(args[2:], ":")
+	default:
+		return nil, fmt.Errorf("Invalid direction '%s' for %s; %v", s.direction, baseName, usage)
+	}
+	if len(strings.TrimSpace(s.expression)) == 0 {
+		return nil, usage
+	}
+	return s, nil
+}
+
+// Name provides the (unique) name of this strategy
+func (s *Selector) Name() string {
+	if s.direction == Threshold {
+		return fmt.Sprintf("%s:%s:%v:%s", baseName, s.direction, s.threshold, s.expression)
+	}
+	return fmt.Sprintf("%s:%s:%s", baseName, s.direction, s.expression)
+}
+
+// Description provides a human-readable description for this strategy
+func (s *Selector) Description() string {
+	switch s.direction {
+	case Max:
+		return "Selects the single prometheus instance with the highest result of the expression"
+	case Min:
+		return "Selects the single prometheus instance with the lowest result of the expression"
+	}
+	return fmt.Sprintf("Selects a prometheus instance at random from those with a result of the expression of at least %v", s.threshold)
+}
+
+// ComparisonMetricName gets the name of the comparison metric/calculation used to make a selection
+func (s *Selector) ComparisonMetricName() string {
+	return s.expression
+}
+
+// RequiresStickySessions answers whether this strategy needs sticky sessions
+func (s *Selector) RequiresStickySessions() bool {
+	return s.direction == Threshold
+}
+
+// NextIndex returns the index of the target that should be used to field the next request
+func (s *Selector) NextIndex(targets []*url.URL) int {
+	if s.direction != Threshold {
+		return 0
+	}
+	next := rand.Intn(len(targets))
+	if log.GetLevel() >= log.DebugLevel {
+		log.Debugf("Strategy %T returned next index: %d", s, next)
+	}
+	return next
+}
+
+// Select chooses elligible prometheus endpoints out of the provided set
+func (s *Selector) Select(endpoints []*locator.PrometheusEndpoint) (err error) {
+	var bestIndex = -1
+	var best float64
+	selected := 0
+	for i, endpoint := range endpoints {
+		endpoint.Selected = false
+		if endpoint.QueryAPI != nil {
+			value, err := s.evaluate(endpoint)
+			if err != nil {
+				log.Errorf("Endpoint %v returned error: %v", endpoint, err)
+				endpoint.Error = err
+				continue
+			}
+			if log.GetLevel() >= log.DebugLevel {
+				log.Debugf("Endpoint %v returned value: %v", endpoint, value)
+			}
+			endpoint.ComparisonMetricValue = value
+			if math.IsNaN(value) || !endpoint.Viable() {
+				continue
+			}
+			switch s.direction {
+			case Threshold:
+				if value >= s.threshold {
+					endpoint.Selected = true
+					selected++
+				}
+			case Max:
+				if bestIndex < 0 || value > best {
+					best, bestIndex = value, i
+				}
+			case Min:
+				if bestIndex < 0 || value < best {
+					best, bestIndex = value, i
+				}
+			}
+		}
+	}
+	if bestIndex >= 0 {
+		endpoints[bestIndex].Selected = true
+		selected++
+	}
+	if selected > 0 {
+		return nil
+	}
+	return fmt.Errorf("No valid/responding endpoints found in the provided list: %v", endpoints)
+}
+
+// evaluate queries the endpoint for the expression, which must produce a scalar, or a vector
+// with a single element
+func (s *Selector) evaluate(endpoint *locator.PrometheusEndpoint) (float64, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), queryTimeout)
+	defer cancel()
+	value, err := endpoint.QueryAPI.Query(ctx, s.expression, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	switch v := value.(type) {
+	case *model.Scalar:
+		return float64(v.Value), nil
+	case model.Vector:
+		if len(v) != 1 {
+			return 0, fmt.Errorf("Expression '%s' returned %d series; expected a single value", s.expression, len(v))
+		}
+		return float64(v[0].Value), nil
+	}
+	return 0, fmt.Errorf("Expression '%s' returned unexpected type: %v", s.expression, value.Type())
+}
@@ -0,0 +1,65 @@
+package expression
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/matt-deboer/mpp/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSelector(t *testing.T) {
+	s, err := NewSelector("max", "count({__name__=~\".+\"})")
+	assert.Nil(t, err)
+	assert.Equal(t, `count({__name__=~".+"})`, s.ComparisonMetricName())
+
+	// expressions containing ':' are split along with the strategy arguments
+	s, err = NewSelector("threshold", "0.5", "job", "up", "ratio")
+	assert.Nil(t, err)
+	assert.Equal(t, 0.5, s.threshold)
+	assert.Equal(t, "job:up:ratio", s.expression)
+	assert.Equal(t, "expression:threshold:0.5:job:up:ratio", s.Name())
+
+	for _, args := range [][]string{{}, {"max"}, {"avg", "up"}, {"threshold", "up"}, {"threshold", "high", "up"}} {
+		_, err = NewSelector(args...)
+		assert.NotNil(t, err, "Expected an error for %v", args)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	// each server answers the 'series' expression with the provided result
+	series := func(result string) *httptest.Server {
+		return testhelpers.NewFakePrometheus(`prometheus_build_info{version="2.3.1"} 1
+`, map[string]string{"series": result})
+	}
+	servers := []*httptest.Server{
+		series(testhelpers.Vector("10")),
+		series(testhelpers.Vector("30")),
+		series(`{"resultType":"scalar","result":[1502134929.97,"20"]}`),
+		series(testhelpers.EmptyVector),
+	}
+	var addrs []string
+	for _, server := range servers {
+		defer server.Close()
+		addrs = append(addrs, server.URL)
+	}
+
+	selected := func(direction string, args ...string) []bool {
+		endpoints, err := locator.ToPrometheusClients(addrs)
+		assert.Nil(t, err)
+		s, err := NewSelector(append([]string{direction}, args...)...)
+		assert.Nil(t, err)
+		assert.Nil(t, s.Select(endpoints))
+		assert.NotNil(t, endpoints[3].Error)
+		result := make([]bool, len(endpoints))
+		for i, endpoint := range endpoints {
+			result[i] = endpoint.Selected
+		}
+		return result
+	}
+
+	assert.Equal(t, []bool{false, true, false, false}, selected(Max, "series"))
+	assert.Equal(t, []bool{true, false, false, false}, selected(Min, "series"))
+	assert.Equal(t, []bool{false, true, true, false}, selected(Threshold, "20", "series"))
+}
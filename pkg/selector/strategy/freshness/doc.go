@@ -0,0 +1,3 @@
+// Package freshness implements target selection for multi-prometheus deployments
+// by selecting an instance at random from those whose data is not lagging behind
+package freshness // import "github.com/matt-deboer/mpp/pkg/selector/strategy/freshness"
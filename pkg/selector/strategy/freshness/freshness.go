@@ -0,0 +1,172 @@
+package freshness
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/matt-deboer/mpp/pkg/selector"
+	"github.com/prometheus/common/model"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	baseName     = "freshness"
+	queryTimeout = 10 * time.Second
+	// lagQuery measures the time since the most recent scrape ingested by the endpoint
+	lagQuery = "time() - max(timestamp(up))"
+	// successQuery measures the ratio of successful scrapes of the endpoint's targets
+	successQuery = "avg(up)"
+)
+
+func init() {
+	rand.Seed(time.Now().UTC().UnixNano())
+	selector.RegisterStrategy(baseName, func(args ...string) (selector.Strategy, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("Strategy %s requires a {tolerance} argument", baseName)
+		}
+		tolerance, err := time.ParseDuration(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid tolerance value '%s' for %s: %v", args[0], baseName, err)
+		}
+		s := &Selector{tolerance: tolerance}
+		if len(args) > 1 {
+			s.minSuccessRatio, err = strconv.ParseFloat(args[1], 64)
+			if err != nil || s.minSuccessRatio < 0 || s.minSuccessRatio > 1 {
+				return nil, fmt.Errorf("Invalid minimum success ratio '%s' for %s; must be between 0 and 1", args[1], baseName)
+			}
+		}
+		return s, nil
+	})
+}
+
+// Selector implements selection of a random prometheus endpoint out of those endpoints whose
+// most recent scrapes lag the freshest endpoint by no more than a tolerance
+type Selector struct {
+	tolerance       time.Duration
+	minSuccessRatio float64
+}
+
+// Name provides the (unique) name of this strategy
+func (s *Selector) Name() string {
+	if s.minSuccessRatio > 0 {
+		return fmt.Sprintf("%s:%s:%v", baseName, s.tolerance, s.minSuccessRatio)
+	}
+	return fmt.Sprintf("%s:%s", baseName, s.tolerance)
+}
+
+// Description provides a human-readable description for this strategy
+func (s *Selector) Description() string {
+	return fmt.Sprintf("Selects a prometheus instance at random from those lagging the freshest instance by at most %s", s.tolerance)
+}
+
+// ComparisonMetricName gets the name of the comparison metric/calculation used to make a selection
+func (s *Selector) ComparisonMetricName() string {
+	return fmt.Sprintf("%s; %s", lagQuery, successQuery)
+}
+
+// RequiresStickySessions answers whether this strategy needs sticky sessions
+func (s *Selector) RequiresStickySessions() bool {
+	return true
+}
+
+// NextIndex returns the index of the target that should be used to field the next request
+func (s *Selector) NextIndex(targets []*url.URL) int {
+	next := rand.Intn(len(targets))
+	if log.GetLevel() >= log.DebugLevel {
+		log.Debugf("Strategy %T returned next index: %d", s, next)
+	}
+	return next
+}
+
+// freshness describes the measured freshness of an endpoint
+type freshness struct {
+	lag          time.Duration
+	successRatio float64
+}
+
+func (f *freshness) String() string {
+	return fmt.Sprintf("lag: %s, up: %.0f%%", f.lag, f.successRatio*100)
+}
+
+// Select chooses elligible prometheus endpoints out of the provided set
+func (s *Selector) Select(endpoints []*locator.PrometheusEndpoint) (err error) {
+	measured := make([]*freshness, len(endpoints))
+	freshest := time.Duration(-1)
+	for i, endpoint := range endpoints {
+		endpoint.Selected = false
+		if endpoint.QueryAPI != nil {
+			f, err := measure(endpoint)
+			if err != nil {
+				log.Errorf("Endpoint %v returned error: %v", endpoint, err)
+				endpoint.Error = err
+				continue
+			}
+			if log.GetLevel() >= log.DebugLevel {
+				log.Debugf("Endpoint %v returned value: %v", endpoint, f)
+			}
+			endpoint.ComparisonMetricValue = f
+			if f.successRatio >= s.minSuccessRatio && endpoint.Viable() {
+				measured[i] = f
+				if freshest < 0 || f.lag < freshest {
+					freshest = f.lag
+				}
+			}
+		}
+	}
+
+	selected := 0
+	for i, f := range measured {
+		if f == nil {
+			continue
+		}
+		if f.lag-freshest > s.tolerance {
+			if log.GetLevel() >= log.DebugLevel {
+				log.Debugf("Excluding endpoint %v, which lags the freshest endpoint by %s", endpoints[i], f.lag-freshest)
+			}
+			continue
+		}
+		endpoints[i].Selected = true
+		selected++
+	}
+	if selected > 0 {
+		return nil
+	}
+	return fmt.Errorf("No valid/responding endpoints found in the provided list: %v", endpoints)
+}
+
+// measure queries the endpoint for the lag of its most recent scrape and its scrape success ratio
+func measure(endpoint *locator.PrometheusEndpoint) (*freshness, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), queryTimeout)
+	defer cancel()
+	lag, err := queryValue(ctx, endpoint, lagQuery)
+	if err != nil {
+		return nil, err
+	}
+	ratio, err := queryValue(ctx, endpoint, successQuery)
+	if err != nil {
+		return nil, err
+	}
+	return &freshness{
+		lag:          time.Duration(lag * float64(time.Second)),
+		successRatio: ratio,
+	}, nil
+}
+
+func queryValue(ctx context.Context, endpoint *locator.PrometheusEndpoint, query string) (float64, error) {
+	value, err := endpoint.QueryAPI.Query(ctx, query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	if v, ok := value.(model.Vector); ok {
+		if len(v) == 0 {
+			return 0, fmt.Errorf("Query '%s' returned no results", query)
+		}
+		return float64(v[0].Value), nil
+	}
+	return 0, fmt.Errorf("Query '%s' returned unexpected type: %v", query, value.Type())
+}
@@ -0,0 +1,55 @@
+package freshness
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/matt-deboer/mpp/pkg/selector"
+	"github.com/matt-deboer/mpp/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectExcludesLaggingEndpoints(t *testing.T) {
+	// each server answers the lag and success ratio queries with the provided values
+	fresh := func(lag, up string) *httptest.Server {
+		return testhelpers.NewFakePrometheus(`prometheus_build_info{version="2.3.1"} 1
+`, map[string]string{lagQuery: testhelpers.Vector(lag), successQuery: testhelpers.Vector(up)})
+	}
+	servers := []*httptest.Server{
+		fresh("12", "1"),
+		fresh("15.5", "0.5"),
+		fresh("300", "1"),
+		testhelpers.NewFakePrometheus(`prometheus_build_info{version="2.3.1"} 1
+`, nil),
+	}
+	var addrs []string
+	for _, server := range servers {
+		defer server.Close()
+		addrs = append(addrs, server.URL)
+	}
+
+	selected := func(args ...string) []bool {
+		endpoints, err := locator.ToPrometheusClients(addrs)
+		assert.Nil(t, err)
+		s, err := selector.NewSelector(nil, append([]string{baseName}, args...)...)
+		assert.Nil(t, err)
+		assert.Nil(t, s.Strategy.Select(endpoints))
+		assert.NotNil(t, endpoints[3].Error)
+		result := make([]bool, len(endpoints))
+		for i, endpoint := range endpoints {
+			result[i] = endpoint.Selected
+		}
+		return result
+	}
+
+	assert.Equal(t, []bool{true, true, false, false}, selected("30s"))
+	assert.Equal(t, []bool{true, false, false, false}, selected("2s"))
+	assert.Equal(t, []bool{true, false, false, false}, selected("30s", "0.9"))
+	assert.Equal(t, []bool{true, true, true, false}, selected("5m"))
+
+	for _, args := range [][]string{{}, {"soon"}, {"30s", "2"}} {
+		_, err := selector.NewSelector(nil, append([]string{baseName}, args...)...)
+		assert.NotNil(t, err, "Expected an error for %v", args)
+	}
+}
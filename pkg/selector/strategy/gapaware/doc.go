@@ -0,0 +1,3 @@
+// Package gapaware implements target selection for multi-prometheus deployments
+// by selecting the instance with the fewest gaps in its recent history
+package gapaware // import "github.com/matt-deboer/mpp/pkg/selector/strategy/gapaware"
@@ -0,0 +1,237 @@
+package gapaware
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/matt-deboer/mpp/pkg/selector"
+	"github.com/matt-deboer/mpp/pkg/version"
+	"github.com/prometheus/client_golang/api/prometheus"
+	"github.com/prometheus/common/model"
+	log "github.com/sirupsen/logrus"
+
+	metrics "github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	baseName     = "gap-aware"
+	defaultStep  = time.Minute
+	queryTimeout = 30 * time.Second
+	// maxIntervals bounds the number of intervals evaluated within the lookback
+	maxIntervals = 11000
+)
+
+func init() {
+	selector.RegisterStrategy(baseName, func(args ...string) (selector.Strategy, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("Strategy %s requires a {lookback} argument", baseName)
+		}
+		lookback, err := time.ParseDuration(args[0])
+		if err != nil || lookback <= 0 {
+			return nil, fmt.Errorf("Invalid lookback value '%s' for %s", args[0], baseName)
+		}
+		step := defaultStep
+		if len(args) > 1 {
+			step, err = time.ParseDuration(args[1])
+			if err != nil || step <= 0 {
+				return nil, fmt.Errorf("Invalid step value '%s' for %s", args[1], baseName)
+			}
+		}
+		if lookback < step {
+			return nil, fmt.Errorf("The lookback (%s) for %s must be at least the step (%s)", lookback, baseName, step)
+		}
+		if lookback/step > maxIntervals {
+			return nil, fmt.Errorf("The lookback (%s) for %s spans more than %d steps of %s", lookback, baseName, maxIntervals, step)
+		}
+		return &Selector{lookback: lookback, step: step, metrics: newMetrics(version.Name)}, nil
+	})
+}
+
+// Selector implements selection of a single prometheus endpoint out of a provided set of endpoints
+// which has the most complete history over a recent lookback period
+type Selector struct {
+	lookback time.Duration
+	step     time.Duration
+	metrics  *gapMetrics
+}
+
+// Name provides the (unique) name of this strategy
+func (s *Selector) Name() string {
+	if s.step != defaultStep {
+		return fmt.Sprintf("%s:%s:%s", baseName, s.lookback, s.step)
+	}
+	return fmt.Sprintf("%s:%s", baseName, s.lookback)
+}
+
+// Description provides a human-readable description for this strategy
+func (s *Selector) Description() string {
+	return fmt.Sprintf("Selects the single prometheus instance with the fewest gaps in the last %s", s.lookback)
+}
+
+// ComparisonMetricName gets the name of the comparison metric/calculation used to make a selection
+func (s *Selector) ComparisonMetricName() string {
+	return s.query()
+}
+
+// RequiresStickySessions answers whether this strategy needs sticky sessions
+func (s *Selector) RequiresStickySessions() bool {
+	return false
+}
+
+// NextIndex returns the index of the target that should be used to field the next request
+func (s *Selector) NextIndex(targets []*url.URL) int {
+	return 0
+}
+
+// query counts the samples of 'up' ingested within each step
+func (s *Selector) query() string {
+	return fmt.Sprintf("sum(count_over_time(up[%s]))", model.Duration(s.step))
+}
+
+// Completeness describes the history of an endpoint over the lookback period
+type Completeness struct {
+	// Score is the ratio of intervals containing samples to the number of intervals
+	Score float64
+	// Missing is the number of intervals containing no samples
+	Missing int
+	// Gaps are the contiguous ranges of missing intervals
+	Gaps []Gap
+}
+
+// Gap is a range of time in which an endpoint has no samples
+type Gap struct {
+	Start, End time.Time
+}
+
+func (g Gap) String() string {
+	return fmt.Sprintf("%s - %s", g.Start.UTC().Format(time.RFC3339), g.End.UTC().Format(time.RFC3339))
+}
+
+func (c *Completeness) String() string {
+	if len(c.Gaps) == 0 {
+		return fmt.Sprintf("%.1f%% complete", c.Score*100)
+	}
+	gaps := make([]string, len(c.Gaps))
+	for i, gap := range c.Gaps {
+		gaps[i] = gap.String()
+	}
+	return fmt.Sprintf("%.1f%% complete; gaps: %s", c.Score*100, strings.Join(gaps, ", "))
+}
+
+// Select chooses elligible prometheus endpoints out of the provided set
+func (s *Selector) Select(endpoints []*locator.PrometheusEndpoint) (err error) {
+	var bestIndex = -1
+	var best *Completeness
+	end := time.Now().Truncate(s.step)
+	// the metrics are replaced once all endpoints have been measured, as measuring may be slow
+	measured := make(map[string]*Completeness)
+	for i, endpoint := range endpoints {
+		endpoint.Selected = false
+		if endpoint.QueryAPI != nil {
+			completeness, err := s.measure(endpoint, end)
+			if err != nil {
+				log.Errorf("Endpoint %v returned error: %v", endpoint, err)
+				endpoint.Error = err
+				continue
+			}
+			if log.GetLevel() >= log.DebugLevel {
+				log.Debugf("Endpoint %v returned value: %v", endpoint, completeness)
+			}
+			endpoint.ComparisonMetricValue = completeness
+			if target, err := url.ParseRequestURI(endpoint.Address); err == nil {
+				measured[locator.BackendKey(target)] = completeness
+			}
+			if endpoint.Viable() && (best == nil || completeness.Missing < best.Missing) {
+				best = completeness
+				bestIndex = i
+			}
+		}
+	}
+	s.metrics.completeness.Reset()
+	s.metrics.gaps.Reset()
+	for backend, completeness := range measured {
+		s.metrics.completeness.WithLabelValues(backend).Set(completeness.Score)
+		s.metrics.gaps.WithLabelValues(backend).Set(float64(len(completeness.Gaps)))
+	}
+	if bestIndex >= 0 {
+		endpoints[bestIndex].Selected = true
+		return nil
+	}
+	return fmt.Errorf("No valid/responding endpoints found in the provided list: %v", endpoints)
+}
+
+// measure performs the range query over the lookback ending at end, treating each step
+// for which no value is returned as a missing interval
+func (s *Selector) measure(endpoint *locator.PrometheusEndpoint, end time.Time) (*Completeness, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), queryTimeout)
+	defer cancel()
+	start := end.Add(-1 * s.lookback)
+	value, err := endpoint.QueryAPI.QueryRange(ctx, s.query(), prometheus.Range{Start: start, End: end, Step: s.step})
+	if err != nil {
+		return nil, err
+	}
+	matrix, ok := value.(model.Matrix)
+	if !ok {
+		return nil, fmt.Errorf("Query '%s' returned unexpected type: %v", s.query(), value.Type())
+	}
+	present := make(map[int64]bool)
+	for _, series := range matrix {
+		for _, pair := range series.Values {
+			if pair.Value > 0 {
+				present[pair.Timestamp.Time().Truncate(time.Second).Unix()] = true
+			}
+		}
+	}
+	return completeness(start, end, s.step, present), nil
+}
+
+// completeness scores the intervals between start and end (inclusive) according to whether
+// a value was present for each, keyed by the unix time of the end of the interval
+func completeness(start, end time.Time, step time.Duration, present map[int64]bool) *Completeness {
+	c := &Completeness{}
+	intervals := 0
+	var gap *Gap
+	for ts := start; !ts.After(end); ts = ts.Add(step) {
+		intervals++
+		if present[ts.Unix()] {
+			gap = nil
+			continue
+		}
+		c.Missing++
+		if gap == nil {
+			c.Gaps = append(c.Gaps, Gap{Start: ts.Add(-1 * step), End: ts})
+			gap = &c.Gaps[len(c.Gaps)-1]
+		} else {
+			gap.End = ts
+		}
+	}
+	c.Score = float64(intervals-c.Missing) / float64(intervals)
+	return c
+}
+
+type gapMetrics struct {
+	completeness *metrics.GaugeVec
+	gaps         *metrics.GaugeVec
+}
+
+func newMetrics(metricsNamespace string) *gapMetrics {
+	m := &gapMetrics{
+		completeness: metrics.NewGaugeVec(metrics.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "gap_aware_completeness_ratio",
+			Help:      "The ratio of intervals within the lookback for which the backend has samples",
+		}, []string{"backend"}),
+		gaps: metrics.NewGaugeVec(metrics.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "gap_aware_gaps",
+			Help:      "The number of gaps within the lookback for which the backend has no samples",
+		}, []string{"backend"}),
+	}
+	m.completeness = selector.RegisterMetric(m.completeness).(*metrics.GaugeVec)
+	m.gaps = selector.RegisterMetric(m.gaps).(*metrics.GaugeVec)
+	return m
+}
@@ -0,0 +1,94 @@
+package gapaware
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/matt-deboer/mpp/pkg/selector"
+	"github.com/matt-deboer/mpp/pkg/testhelpers"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompleteness(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	end := start.Add(10 * time.Minute)
+	present := make(map[int64]bool)
+	for i := 0; i <= 10; i++ {
+		if i != 3 && i != 4 && i != 8 {
+			present[start.Add(time.Duration(i)*time.Minute).Unix()] = true
+		}
+	}
+	c := completeness(start, end, time.Minute, present)
+	assert.Equal(t, 3, c.Missing)
+	assert.InDelta(t, 8.0/11.0, c.Score, 0.0001)
+	assert.Equal(t, []Gap{
+		{Start: start.Add(2 * time.Minute), End: start.Add(4 * time.Minute)},
+		{Start: start.Add(7 * time.Minute), End: start.Add(8 * time.Minute)},
+	}, c.Gaps)
+}
+
+// fakePrometheus answers range queries with values at every step, except for the missing steps
+func fakePrometheus(missing ...int) *httptest.Server {
+	return httptest.NewServer(&testhelpers.FakePrometheus{
+		Metrics: `prometheus_build_info{version="2.3.1"} 1` + "\n",
+		QueryRange: func(query string, start, end time.Time, step time.Duration) string {
+			var values []string
+			for i, ts := 0, start.Unix(); ts <= end.Unix(); i, ts = i+1, ts+int64(step.Seconds()) {
+				skip := false
+				for _, m := range missing {
+					skip = skip || m == i
+				}
+				if !skip {
+					values = append(values, fmt.Sprintf(`[%v,"4"]`, ts))
+				}
+			}
+			return fmt.Sprintf(`{"resultType":"matrix","result":[{"metric":{},"values":[%s]}]}`, strings.Join(values, ","))
+		},
+	})
+}
+
+func TestSelectFewestGaps(t *testing.T) {
+	servers := []*httptest.Server{
+		fakePrometheus(3, 4, 5),
+		fakePrometheus(7),
+		fakePrometheus(1, 9),
+	}
+	var addrs []string
+	for _, server := range servers {
+		defer server.Close()
+		addrs = append(addrs, server.URL)
+	}
+	endpoints, err := locator.ToPrometheusClients(addrs)
+	assert.Nil(t, err)
+
+	s, err := selector.NewSelector(nil, baseName, "10m")
+	assert.Nil(t, err)
+	assert.Nil(t, s.Strategy.Select(endpoints))
+	assert.Equal(t, []bool{false, true, false}, []bool{endpoints[0].Selected, endpoints[1].Selected, endpoints[2].Selected})
+
+	c := endpoints[0].ComparisonMetricValue.(*Completeness)
+	assert.Equal(t, 3, c.Missing)
+	assert.Len(t, c.Gaps, 1)
+	assert.Len(t, endpoints[2].ComparisonMetricValue.(*Completeness).Gaps, 2)
+
+	// metrics are labelled by backend
+	target, _ := url.Parse(addrs[2])
+	var gaps dto.Metric
+	assert.Nil(t, s.Strategy.(*Selector).metrics.gaps.WithLabelValues(locator.BackendKey(target)).Write(&gaps))
+	assert.Equal(t, 2.0, gaps.GetGauge().GetValue())
+
+	// the strategy may be created more than once, despite registering metrics
+	_, err = selector.NewSelector(nil, baseName, "1h", "5m")
+	assert.Nil(t, err)
+
+	for _, args := range [][]string{{}, {"recent"}, {"1m", "5m"}, {"1h", "-1m"}, {"720h", "1s"}} {
+		_, err := selector.NewSelector(nil, append([]string{baseName}, args...)...)
+		assert.NotNil(t, err, "Expected an error for %v", args)
+	}
+}
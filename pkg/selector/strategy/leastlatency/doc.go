@@ -0,0 +1,3 @@
+// Package leastlatency implements target selection for multi-prometheus deployments
+// by balancing requests across instances according to their recent response latency
+package leastlatency // import "github.com/matt-deboer/mpp/pkg/selector/strategy/leastlatency"
@@ -0,0 +1,236 @@
+package leastlatency
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/matt-deboer/mpp/pkg/selector"
+	"github.com/matt-deboer/mpp/pkg/version"
+	log "github.com/sirupsen/logrus"
+
+	metrics "github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	baseName     = "least-latency"
+	defaultDecay = 10 * time.Second
+)
+
+func init() {
+	rand.Seed(time.Now().UTC().UnixNano())
+	selector.RegisterStrategy(baseName, func(args ...string) (selector.Strategy, error) {
+		decay := defaultDecay
+		if len(args) > 0 {
+			var err error
+			decay, err = time.ParseDuration(args[0])
+			if err != nil || decay <= 0 {
+				return nil, fmt.Errorf("Invalid decay value '%s' for %s", args[0], baseName)
+			}
+		}
+		return NewSelector(decay), nil
+	})
+}
+
+// backendStats tracks the latency and load of a single backend
+type backendStats struct {
+	// ewma is the exponentially weighted moving average of response latency, in seconds
+	ewma     float64
+	updated  time.Time
+	inFlight int
+}
+
+// Selector implements selection of all viable prometheus endpoints, balancing requests
+// amongst them by choosing the less loaded of two randomly chosen targets, based on the
+// moving average of their response latency and their in-flight requests
+type Selector struct {
+	decay     time.Duration
+	mutex     sync.Mutex
+	backends  map[string]*backendStats
+	ewmaGauge *metrics.GaugeVec
+}
+
+// NewSelector creates a least-latency strategy, where decay is the time constant of the
+// moving average of response latency
+func NewSelector(decay time.Duration) *Selector {
+	gauge := metrics.NewGaugeVec(metrics.GaugeOpts{
+		Namespace: version.Name,
+		Name:      "least_latency_ewma_seconds",
+		Help:      "The exponentially weighted moving average of response latency, by backend",
+	}, []string{"backend"})
+	return &Selector{
+		decay:     decay,
+		backends:  make(map[string]*backendStats),
+		ewmaGauge: selector.RegisterMetric(gauge).(*metrics.GaugeVec),
+	}
+}
+
+// Name provides the (unique) name of this strategy
+func (s *Selector) Name() string {
+	if s.decay != defaultDecay {
+		return fmt.Sprintf("%s:%s", baseName, s.decay)
+	}
+	return baseName
+}
+
+// Description provides a human-readable description for this strategy
+func (s *Selector) Description() string {
+	return "Balances requests across prometheus instances, preferring those with the least recent latency"
+}
+
+// ComparisonMetricName gets the name of the comparison metric/calculation used to make a selection
+func (s *Selector) ComparisonMetricName() string {
+	return "latency (ewma)"
+}
+
+// RequiresStickySessions answers whether this strategy needs sticky sessions
+func (s *Selector) RequiresStickySessions() bool {
+	return true
+}
+
+// NextIndex returns the index of the target that should be used to field the next request, using
+// the power of two choices: of two distinct targets chosen at random, the one with the lower cost
+func (s *Selector) NextIndex(targets []*url.URL) int {
+	if len(targets) < 2 {
+		return 0
+	}
+	a := rand.Intn(len(targets))
+	b := rand.Intn(len(targets) - 1)
+	if b >= a {
+		b++
+	}
+	s.mutex.Lock()
+	costA, costB := s.cost(locator.BackendKey(targets[a])), s.cost(locator.BackendKey(targets[b]))
+	s.mutex.Unlock()
+
+	next := a
+	if costB < costA {
+		next = b
+	}
+	if log.GetLevel() >= log.DebugLevel {
+		log.Debugf("Strategy %T returned next index: %d (costs: %d => %f, %d => %f)", s, next, a, costA, b, costB)
+	}
+	return next
+}
+
+// cost estimates the latency of a new request to the backend, as the moving average of its latency
+// scaled by the number of requests which would then be in flight; backends without a latency (yet)
+// are assumed to have the average latency of the others
+func (s *Selector) cost(backend string) float64 {
+	stats, ok := s.backends[backend]
+	if !ok || stats.updated.IsZero() {
+		inFlight := 0
+		if ok {
+			inFlight = stats.inFlight
+		}
+		return s.averageLatency() * float64(inFlight+1)
+	}
+	return stats.ewma * float64(stats.inFlight+1)
+}
+
+func (s *Selector) averageLatency() float64 {
+	var sum float64
+	var count int
+	for _, stats := range s.backends {
+		if !stats.updated.IsZero() {
+			sum += stats.ewma
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+// RequestStarted records a request in flight to the target
+func (s *Selector) RequestStarted(target *url.URL) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.stats(locator.BackendKey(target)).inFlight++
+}
+
+// RequestCompleted updates the moving average of latency of the target with the request's duration
+func (s *Selector) RequestCompleted(target *url.URL, duration time.Duration) {
+	backend := locator.BackendKey(target)
+	s.mutex.Lock()
+	stats := s.stats(backend)
+	if stats.inFlight > 0 {
+		stats.inFlight--
+	}
+	now := time.Now()
+	if stats.updated.IsZero() {
+		stats.ewma = duration.Seconds()
+	} else {
+		w := math.Exp(-1 * now.Sub(stats.updated).Seconds() / s.decay.Seconds())
+		stats.ewma = stats.ewma*w + duration.Seconds()*(1-w)
+	}
+	stats.updated = now
+	ewma := stats.ewma
+	s.mutex.Unlock()
+
+	s.ewmaGauge.WithLabelValues(backend).Set(ewma)
+}
+
+// stats returns the stats of the backend, creating them if necessary; the mutex must be held
+func (s *Selector) stats(backend string) *backendStats {
+	stats, ok := s.backends[backend]
+	if !ok {
+		stats = &backendStats{}
+		s.backends[backend] = stats
+	}
+	return stats
+}
+
+// latency reports the current latency and load of a backend on the status page
+type latency struct {
+	selector *Selector
+	backend  string
+}
+
+func (l *latency) String() string {
+	l.selector.mutex.Lock()
+	defer l.selector.mutex.Unlock()
+	stats, ok := l.selector.backends[l.backend]
+	if !ok || stats.updated.IsZero() {
+		return "no requests"
+	}
+	return fmt.Sprintf("%s (in flight: %d)", time.Duration(stats.ewma*float64(time.Second)).Truncate(time.Microsecond), stats.inFlight)
+}
+
+// Select chooses elligible prometheus endpoints out of the provided set
+func (s *Selector) Select(endpoints []*locator.PrometheusEndpoint) (err error) {
+	selected := make(map[string]bool)
+	for _, endpoint := range endpoints {
+		endpoint.Selected = false
+		if endpoint.QueryAPI != nil && endpoint.Error == nil && endpoint.Viable() {
+			target, err := url.ParseRequestURI(endpoint.Address)
+			if err != nil {
+				continue
+			}
+			backend := locator.BackendKey(target)
+			endpoint.ComparisonMetricValue = &latency{selector: s, backend: backend}
+			endpoint.Selected = true
+			selected[backend] = true
+		}
+	}
+
+	// forget backends which are no longer selected
+	s.mutex.Lock()
+	for backend := range s.backends {
+		if !selected[backend] {
+			delete(s.backends, backend)
+			s.ewmaGauge.DeleteLabelValues(backend)
+		}
+	}
+	s.mutex.Unlock()
+
+	if len(selected) > 0 {
+		return nil
+	}
+	return fmt.Errorf("No valid/responding endpoints found in the provided list: %v", endpoints)
+}
@@ -0,0 +1,66 @@
+package leastlatency
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/matt-deboer/mpp/pkg/selector"
+	"github.com/stretchr/testify/assert"
+)
+
+func targets(addrs ...string) []*url.URL {
+	var urls []*url.URL
+	for _, addr := range addrs {
+		u, _ := url.Parse(addr)
+		urls = append(urls, u)
+	}
+	return urls
+}
+
+func TestNextIndexPrefersLeastLatency(t *testing.T) {
+	sel, err := selector.NewSelector(nil, baseName, "1m")
+	assert.Nil(t, err)
+	s := sel.Strategy.(*Selector)
+	assert.Implements(t, (*selector.Observer)(nil), s)
+
+	urls := targets("http://fast:9090", "http://slow:9090")
+	s.RequestStarted(urls[0])
+	s.RequestCompleted(urls[0], 100*time.Millisecond)
+	s.RequestStarted(urls[1])
+	s.RequestCompleted(urls[1], 500*time.Millisecond)
+
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, 0, s.NextIndex(urls))
+	}
+
+	// in-flight requests increase the cost of the fast backend beyond that of the slow one
+	for i := 0; i < 5; i++ {
+		s.RequestStarted(urls[0])
+	}
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, 1, s.NextIndex(urls))
+	}
+
+	// the moving average converges on recent latency
+	stats := s.backends[locator.BackendKey(urls[1])]
+	stats.updated = time.Now().Add(-5 * time.Minute)
+	s.RequestCompleted(urls[1], 10*time.Millisecond)
+	assert.InDelta(t, 0.01, stats.ewma, 0.005)
+	assert.Equal(t, 0, stats.inFlight)
+	assert.Contains(t, (&latency{selector: s, backend: locator.BackendKey(urls[1])}).String(), "ms (in flight: 0)")
+}
+
+func TestNextIndexDistributesAmongUnknownTargets(t *testing.T) {
+	s := NewSelector(defaultDecay)
+	urls := targets("http://a:9090", "http://b:9090", "http://c:9090")
+	counts := make([]int, len(urls))
+	for i := 0; i < 300; i++ {
+		counts[s.NextIndex(urls)]++
+	}
+	for i, count := range counts {
+		assert.True(t, count > 0, "Expected requests to be routed to %v", urls[i])
+	}
+	assert.Equal(t, 0, s.NextIndex(urls[:1]))
+}
@@ -0,0 +1,3 @@
+// Package preferred implements target selection for multi-prometheus deployments
+// by selecting the most preferred viable instances from an ordered list of preferences
+package preferred // import "github.com/matt-deboer/mpp/pkg/selector/strategy/preferred"
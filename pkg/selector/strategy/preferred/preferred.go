@@ -0,0 +1,224 @@
+package preferred
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/matt-deboer/mpp/pkg/selector"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	baseName = "preferred"
+	// preferenceSeparator separates preferences; commas separate the stages of a chain
+	preferenceSeparator = "|"
+)
+
+func init() {
+	rand.Seed(time.Now().UTC().UnixNano())
+	selector.RegisterStrategy(baseName, func(args ...string) (selector.Strategy, error) {
+		if len(args) < 2 {
+			return nil, fmt.Errorf("Strategy %s requires arguments {hold-down}:{preference}[|{preference}...]", baseName)
+		}
+		holdDown, err := time.ParseDuration(args[0])
+		if err != nil || holdDown < 0 {
+			return nil, fmt.Errorf("Invalid hold-down value '%s' for %s", args[0], baseName)
+		}
+		// address patterns may contain ':'
+		return NewSelector(holdDown, strings.Split(strings.Join(args[1:], ":"), preferenceSeparator)...)
+	})
+}
+
+// preference matches endpoints either by the value of a label, or by an address pattern
+type preference struct {
+	spec    string
+	label   string
+	value   string
+	address *regexp.Regexp
+}
+
+// parsePreference parses a preference of the form '{label}={value}', or an address pattern
+// in which '*' matches any sequence of characters
+func parsePreference(spec string) (*preference, error) {
+	spec = strings.TrimSpace(spec)
+	if len(spec) == 0 {
+		return nil, fmt.Errorf("Invalid empty preference for %s", baseName)
+	}
+	p := &preference{spec: spec}
+	if i := strings.Index(spec, "="); i > 0 && !strings.Contains(spec[:i], "/") {
+		p.label, p.value = spec[:i], spec[i+1:]
+		return p, nil
+	}
+	pattern := strings.Replace(regexp.QuoteMeta(spec), `\*`, ".*", -1)
+	p.address = regexp.MustCompile("^" + pattern + "$")
+	return p, nil
+}
+
+func (p *preference) matches(endpoint *locator.PrometheusEndpoint) bool {
+	if p.address != nil {
+		return p.address.MatchString(endpoint.Address)
+	}
+	value, ok := endpoint.Labels[p.label]
+	return ok && value == p.value
+}
+
+// Selector implements selection of the most preferred viable prometheus endpoints out of a provided
+// set of endpoints; traffic falls back to less preferred endpoints upon failure, returning to more
+// preferred endpoints only once they have been viable for the hold-down period
+type Selector struct {
+	holdDown    time.Duration
+	preferences []*preference
+	// the position in the preferences of the current selection, and the time since which each
+	// endpoint has been continuously viable
+	mutex        sync.Mutex
+	position     int
+	viableSince  map[string]time.Time
+	hasSelection bool
+}
+
+// NewSelector creates a preferred strategy from an ordered list of preferences
+func NewSelector(holdDown time.Duration, preferences ...string) (*Selector, error) {
+	s := &Selector{holdDown: holdDown, viableSince: make(map[string]time.Time)}
+	for _, spec := range preferences {
+		p, err := parsePreference(spec)
+		if err != nil {
+			return nil, err
+		}
+		s.preferences = append(s.preferences, p)
+	}
+	return s, nil
+}
+
+// Name provides the (unique) name of this strategy
+func (s *Selector) Name() string {
+	specs := make([]string, len(s.preferences))
+	for i, p := range s.preferences {
+		specs[i] = p.spec
+	}
+	return fmt.Sprintf("%s:%s:%s", baseName, s.holdDown, strings.Join(specs, preferenceSeparator))
+}
+
+// Description provides a human-readable description for this strategy
+func (s *Selector) Description() string {
+	return fmt.Sprintf("Selects the most preferred viable prometheus instance, returning to more preferred instances after %s", s.holdDown)
+}
+
+// ComparisonMetricName gets the name of the comparison metric/calculation used to make a selection
+func (s *Selector) ComparisonMetricName() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.hasSelection {
+		return "preference"
+	}
+	return fmt.Sprintf("preference (current: %s)", s.describe(s.position))
+}
+
+// RequiresStickySessions answers whether this strategy needs sticky sessions
+func (s *Selector) RequiresStickySessions() bool {
+	return true
+}
+
+// NextIndex returns the index of the target that should be used to field the next request
+func (s *Selector) NextIndex(targets []*url.URL) int {
+	next := rand.Intn(len(targets))
+	if log.GetLevel() >= log.DebugLevel {
+		log.Debugf("Strategy %T returned next index: %d", s, next)
+	}
+	return next
+}
+
+// rank returns the position of the first preference matched by the endpoint; endpoints which match
+// no preference are least preferred
+func (s *Selector) rank(endpoint *locator.PrometheusEndpoint) int {
+	for i, p := range s.preferences {
+		if p.matches(endpoint) {
+			return i
+		}
+	}
+	return len(s.preferences)
+}
+
+func (s *Selector) describe(position int) string {
+	if position < len(s.preferences) {
+		return fmt.Sprintf("#%d %s", position+1, s.preferences[position].spec)
+	}
+	return "unmatched"
+}
+
+// Select chooses elligible prometheus endpoints out of the provided set
+func (s *Selector) Select(endpoints []*locator.PrometheusEndpoint) (err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	ranks := make([]int, len(endpoints))
+	viable := make([]bool, len(endpoints))
+	viableSince := make(map[string]time.Time)
+	// the most preferred position having any viable endpoints, and having endpoints viable for the hold-down
+	best, settled := -1, -1
+	for i, endpoint := range endpoints {
+		endpoint.Selected = false
+		ranks[i] = s.rank(endpoint)
+		viable[i] = endpoint.QueryAPI != nil && endpoint.Error == nil && endpoint.Viable()
+		if !viable[i] {
+			endpoint.ComparisonMetricValue = s.describe(ranks[i])
+			continue
+		}
+		since, ok := s.viableSince[endpoint.Address]
+		if !ok {
+			since = now
+		}
+		viableSince[endpoint.Address] = since
+		endpoint.ComparisonMetricValue = fmt.Sprintf("%s (viable for %s)", s.describe(ranks[i]), now.Sub(since).Truncate(time.Second))
+		if best < 0 || ranks[i] < best {
+			best = ranks[i]
+		}
+		if now.Sub(since) >= s.holdDown && (settled < 0 || ranks[i] < settled) {
+			settled = ranks[i]
+		}
+	}
+	s.viableSince = viableSince
+
+	if best < 0 {
+		return fmt.Errorf("No valid/responding endpoints found in the provided list: %v", endpoints)
+	}
+
+	position := best
+	if s.hasSelection && best < s.position {
+		// return to a more preferred position only once it has been viable for the hold-down,
+		// unless the current position has failed
+		position = s.position
+		if settled >= 0 && settled < position {
+			position = settled
+		}
+		if !s.hasViable(ranks, viable, position) {
+			position = best
+		}
+	}
+	if s.hasSelection && position != s.position {
+		log.Infof("Preferred selection moved from %s to %s", s.describe(s.position), s.describe(position))
+	}
+	s.position, s.hasSelection = position, true
+
+	for i, endpoint := range endpoints {
+		if viable[i] && ranks[i] == position {
+			endpoint.Selected = true
+		}
+	}
+	return nil
+}
+
+func (s *Selector) hasViable(ranks []int, viable []bool, position int) bool {
+	for i, rank := range ranks {
+		if viable[i] && rank == position {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package preferred
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/matt-deboer/mpp/pkg/selector"
+	"github.com/prometheus/client_golang/api/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeQueryAPI struct {
+	err error
+}
+
+func (q *fakeQueryAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, error) {
+	return model.Vector{}, q.err
+}
+
+func (q *fakeQueryAPI) QueryRange(ctx context.Context, query string, r prometheus.Range) (model.Value, error) {
+	return model.Matrix{}, q.err
+}
+
+// endpoints creates fresh endpoints (as in each selection round) for each of the zones, of
+// which the failed ones are not viable
+func endpoints(failed ...string) []*locator.PrometheusEndpoint {
+	var result []*locator.PrometheusEndpoint
+	for i, zone := range []string{"us-east-1a", "us-east-1b", "us-east-1c"} {
+		api := &fakeQueryAPI{}
+		for _, f := range failed {
+			if f == zone {
+				api.err = fmt.Errorf("failed")
+			}
+		}
+		result = append(result, &locator.PrometheusEndpoint{
+			Address:  fmt.Sprintf("http://prometheus-%d:9090", i),
+			Labels:   map[string]string{"zone": zone},
+			QueryAPI: api,
+		})
+	}
+	return result
+}
+
+func selected(t *testing.T, s selector.Strategy, endpoints []*locator.PrometheusEndpoint) []string {
+	assert.Nil(t, s.Select(endpoints))
+	var addrs []string
+	for _, endpoint := range endpoints {
+		if endpoint.Selected {
+			addrs = append(addrs, endpoint.Address)
+		}
+	}
+	return addrs
+}
+
+func TestPreferredFailover(t *testing.T) {
+	sel, err := selector.NewSelector(nil, "preferred", "5m", "zone=us-east-1a|http", "//prometheus-2", "9090")
+	assert.Nil(t, err)
+	s := sel.Strategy.(*Selector)
+	assert.Equal(t, "preferred:5m0s:zone=us-east-1a|http://prometheus-2:9090", s.Name())
+
+	assert.Equal(t, []string{"http://prometheus-0:9090"}, selected(t, s, endpoints()))
+	assert.Equal(t, "preference (current: #1 zone=us-east-1a)", s.ComparisonMetricName())
+
+	// falls back immediately upon failure
+	assert.Equal(t, []string{"http://prometheus-2:9090"}, selected(t, s, endpoints("us-east-1a")))
+	// unmatched endpoints are least preferred
+	assert.Equal(t, []string{"http://prometheus-1:9090"}, selected(t, s, endpoints("us-east-1a", "us-east-1c")))
+	assert.Equal(t, "preference (current: unmatched)", s.ComparisonMetricName())
+
+	// the primary must be viable for the hold-down before it is returned to
+	assert.Equal(t, []string{"http://prometheus-1:9090"}, selected(t, s, endpoints()))
+	s.viableSince["http://prometheus-2:9090"] = time.Now().Add(-6 * time.Minute)
+	assert.Equal(t, []string{"http://prometheus-2:9090"}, selected(t, s, endpoints()))
+	s.viableSince["http://prometheus-0:9090"] = time.Now().Add(-6 * time.Minute)
+	assert.Equal(t, []string{"http://prometheus-0:9090"}, selected(t, s, endpoints()))
+
+	// a failure resets the time for which an endpoint has been viable
+	assert.Equal(t, []string{"http://prometheus-2:9090"}, selected(t, s, endpoints("us-east-1a")))
+	assert.Equal(t, []string{"http://prometheus-2:9090"}, selected(t, s, endpoints()))
+
+	// the current position failing while a more preferred one is held down falls back to the best available
+	assert.Equal(t, []string{"http://prometheus-0:9090"}, selected(t, s, endpoints("us-east-1c")))
+
+	assert.NotNil(t, s.Select(endpoints("us-east-1a", "us-east-1b", "us-east-1c")))
+
+	for _, args := range [][]string{{"preferred"}, {"preferred", "soon", "zone=a"}, {"preferred", "5m", "zone=a|"}} {
+		_, err := selector.NewSelector(nil, args...)
+		assert.NotNil(t, err, "Expected an error for %v", args)
+	}
+}
@@ -59,7 +59,10 @@ func (s *Selector) Select(endpoints []*locator.PrometheusEndpoint) (err error) {
 	for _, endpoint := range endpoints {
 		endpoint.Selected = false
 		if endpoint.QueryAPI != nil {
-			scraped, err := locator.ScrapeMetric(endpoint.Address, "prometheus_build_info")
+			scraped, err := endpoint.Metric("prometheus_build_info")
+			if err == nil && scraped == nil {
+				err = fmt.Errorf("Metric prometheus_build_info was not found")
+			}
 			if err != nil {
 				log.Errorf("Endpoint %v returned error: %v", endpoint, err)
 				endpoint.Error = err
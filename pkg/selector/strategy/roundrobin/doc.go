@@ -0,0 +1,3 @@
+// Package roundrobin implements target selection for multi-prometheus deployments
+// by distributing requests amongst all viable instances in (smooth) weighted round-robin order
+package roundrobin // import "github.com/matt-deboer/mpp/pkg/selector/strategy/roundrobin"
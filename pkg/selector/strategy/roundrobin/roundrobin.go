@@ -0,0 +1,94 @@
+package roundrobin
+
+import (
+	"net/url"
+	"sync"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/matt-deboer/mpp/pkg/selector"
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	selector.RegisterStrategy("round-robin", func(args ...string) (selector.Strategy, error) {
+		return NewSelector(), nil
+	})
+}
+
+// Selector implements selection of all viable prometheus endpoints, distributing requests amongst
+// them in proportion to their weights using smooth weighted round-robin (as in nginx), which
+// interleaves the endpoints rather than sending consecutive runs of requests to each
+type Selector struct {
+	mutex   sync.Mutex
+	weights map[string]float64
+	current map[string]float64
+}
+
+// NewSelector creates a round-robin strategy
+func NewSelector() *Selector {
+	return &Selector{
+		weights: make(map[string]float64),
+		current: make(map[string]float64),
+	}
+}
+
+// Name provides the (unique) name of this strategy
+func (s *Selector) Name() string {
+	return "round-robin"
+}
+
+// Description provides a human-readable description for this strategy
+func (s *Selector) Description() string {
+	return "Distributes requests across prometheus instances in weighted round-robin order"
+}
+
+// ComparisonMetricName gets the name of the comparison metric/calculation used to make a selection
+func (s *Selector) ComparisonMetricName() string {
+	return "weight"
+}
+
+// RequiresStickySessions answers whether this strategy needs sticky sessions
+func (s *Selector) RequiresStickySessions() bool {
+	return true
+}
+
+// NextIndex returns the index of the target that should be used to field the next request; each
+// target's current weight is increased by its weight, and the target with the highest current
+// weight is chosen, after which its current weight is reduced by the total of all weights
+func (s *Selector) NextIndex(targets []*url.URL) int {
+	if len(targets) < 2 {
+		return 0
+	}
+	s.mutex.Lock()
+	weights, total := locator.TargetWeights(s.weights, targets)
+	next := -1
+	for i, target := range targets {
+		backend := locator.BackendKey(target)
+		s.current[backend] += weights[i]
+		if next < 0 || s.current[backend] > s.current[locator.BackendKey(targets[next])] {
+			next = i
+		}
+	}
+	s.current[locator.BackendKey(targets[next])] -= total
+	s.mutex.Unlock()
+
+	if log.GetLevel() >= log.DebugLevel {
+		log.Debugf("Strategy %T returned next index: %d", s, next)
+	}
+	return next
+}
+
+// Select chooses elligible prometheus endpoints out of the provided set; endpoints with
+// a weight of 0 are considered to be drained, and are not selected
+func (s *Selector) Select(endpoints []*locator.PrometheusEndpoint) error {
+	weights, err := locator.SelectWeighted(endpoints)
+	s.mutex.Lock()
+	s.weights = weights
+	for backend := range s.current {
+		if _, ok := weights[backend]; !ok {
+			delete(s.current, backend)
+		}
+	}
+	s.mutex.Unlock()
+	return err
+}
@@ -0,0 +1,33 @@
+package roundrobin
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/matt-deboer/mpp/pkg/selector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWeightedRoundRobin(t *testing.T) {
+	sel, err := selector.NewSelector(nil, "round-robin")
+	assert.Nil(t, err)
+	s := sel.Strategy.(*Selector)
+	s.weights = map[string]float64{"http://a:9090": 5, "http://c:9090": 1}
+
+	var targets []*url.URL
+	for _, addr := range []string{"http://a:9090", "http://b:9090", "http://c:9090"} {
+		u, _ := url.Parse(addr)
+		targets = append(targets, u)
+	}
+	var order []int
+	for i := 0; i < 7; i++ {
+		order = append(order, s.NextIndex(targets))
+	}
+	// requests to the heavier endpoint are interleaved with those to the others
+	assert.Equal(t, []int{0, 0, 1, 0, 2, 0, 0}, order)
+	assert.Equal(t, 0, s.NextIndex(targets[1:2]))
+
+	// the current weights of endpoints which are no longer selected are discarded
+	assert.NotNil(t, s.Select(nil))
+	assert.Equal(t, 0, len(s.current))
+}
@@ -2,7 +2,11 @@ package singlemostdata
 
 import (
 	"fmt"
+	"math"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/matt-deboer/mpp/pkg/locator"
 	"github.com/matt-deboer/mpp/pkg/selector"
@@ -10,7 +14,12 @@ import (
 )
 
 const (
-	comparisonMetricName = "prometheus_local_storage_ingested_samples_total"
+	comparisonMetricName = "ingested samples"
+	// prometheus 1.x
+	ingestedSamplesMetricName = "prometheus_local_storage_ingested_samples_total"
+	// prometheus 2.x
+	appendedSamplesMetricName = "prometheus_tsdb_head_samples_appended_total"
+	lowestTimestampMetricName = "prometheus_tsdb_lowest_timestamp"
 )
 
 func init() {
@@ -50,33 +59,102 @@ func (s *Selector) NextIndex(targets []*url.URL) int {
 	return 0
 }
 
-// Select chooses elligible prometheus endpoints out of the provided set
+// Select chooses elligible prometheus endpoints out of the provided set; as the measure used for
+// prometheus 2.x is an estimate, which is not comparable with the exact count of 1.x, endpoints are
+// only compared with those of the same major version, and the newest major version is preferred
 func (s *Selector) Select(endpoints []*locator.PrometheusEndpoint) (err error) {
-	var mostDataIndex = -1
-	var mostData int64
+	mostDataIndex := make(map[int]int)
+	newestMajor := -1
 	for i, endpoint := range endpoints {
 		endpoint.Selected = false
 		if endpoint.QueryAPI != nil {
-			scraped, err := locator.ScrapeMetric(endpoint.Address, "prometheus_local_storage_ingested_samples_total")
+			major, sampleValue, metricName, err := ingestedSamples(endpoint)
 			if err != nil {
 				log.Errorf("Endpoint %v returned error: %v", endpoint, err)
 				endpoint.Error = err
 			} else {
 				if log.GetLevel() >= log.DebugLevel {
-					log.Debugf("Endpoint %v returned value: %v", endpoint, scraped)
+					log.Debugf("Endpoint %v returned value: %d (%s)", endpoint, sampleValue, metricName)
 				}
-				sampleValue := int64(scraped.Value)
+				endpoint.ComparisonMetricName = metricName
 				endpoint.ComparisonMetricValue = sampleValue
-				if sampleValue > mostData && endpoint.Viable() {
-					mostData = sampleValue
-					mostDataIndex = i
+				if mostData, ok := mostDataIndex[major]; ok && sampleValue <= endpoints[mostData].ComparisonMetricValue.(int64) {
+					continue
+				}
+				if sampleValue > 0 && endpoint.Viable() {
+					mostDataIndex[major] = i
+					if major > newestMajor {
+						newestMajor = major
+					}
 				}
 			}
 		}
 	}
-	if mostDataIndex >= 0 {
-		endpoints[mostDataIndex].Selected = true
+	if mostData, ok := mostDataIndex[newestMajor]; ok {
+		if len(mostDataIndex) > 1 && log.GetLevel() >= log.DebugLevel {
+			log.Debugf("Comparing only the endpoints of prometheus %d.x, out of %d major versions", newestMajor, len(mostDataIndex))
+		}
+		endpoints[mostData].Selected = true
 		return nil
 	}
 	return fmt.Errorf("No valid/responding endpoints found in the provided list: %v", endpoints)
 }
+
+// ingestedSamples measures the data held by the endpoint, using the metrics exported by its major version
+// of prometheus, returning the major version and the measure, along with a description of the metric(s)
+// it is based upon
+func ingestedSamples(endpoint *locator.PrometheusEndpoint) (int, int64, string, error) {
+	major, err := majorVersion(endpoint)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	if major < 2 {
+		ingested, err := requireMetric(endpoint, ingestedSamplesMetricName)
+		if err != nil {
+			return 0, 0, "", err
+		}
+		return major, int64(ingested.Value), ingestedSamplesMetricName, nil
+	}
+
+	appended, err := requireMetric(endpoint, appendedSamplesMetricName)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	// the appended samples count restarts along with prometheus, while the data persisted by the tsdb
+	// does not; scale the count by the ratio of the retention depth to the uptime to estimate the
+	// total number of samples held
+	lowest, err := endpoint.Metric(lowestTimestampMetricName)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	if lowest != nil && lowest.Value > 0 && lowest.Value < math.MaxInt64 && endpoint.Uptime > 0 {
+		retention := time.Since(time.Unix(0, int64(lowest.Value)*int64(time.Millisecond)))
+		if retention > endpoint.Uptime {
+			return major, int64(appended.Value * float64(retention) / float64(endpoint.Uptime)),
+				fmt.Sprintf("%s * retention (%s) / uptime", appendedSamplesMetricName, retention.Truncate(time.Second)), nil
+		}
+	}
+	return major, int64(appended.Value), appendedSamplesMetricName, nil
+}
+
+// majorVersion determines the major version of prometheus from the endpoint's 'prometheus_build_info'
+func majorVersion(endpoint *locator.PrometheusEndpoint) (int, error) {
+	buildInfo, err := requireMetric(endpoint, "prometheus_build_info")
+	if err != nil {
+		return 0, err
+	}
+	version := buildInfo.Label("version")
+	major, err := strconv.Atoi(strings.TrimPrefix(strings.SplitN(version, ".", 2)[0], "v"))
+	if err != nil {
+		return 0, fmt.Errorf("Unable to parse prometheus version '%s': %v", version, err)
+	}
+	return major, nil
+}
+
+func requireMetric(endpoint *locator.PrometheusEndpoint, name string) (*locator.LabeledValue, error) {
+	scraped, err := endpoint.Metric(name)
+	if err == nil && scraped == nil {
+		err = fmt.Errorf("Metric %s was not found", name)
+	}
+	return scraped, err
+}
@@ -0,0 +1,83 @@
+package singlemostdata
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/matt-deboer/mpp/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectAcrossVersions(t *testing.T) {
+	started := time.Now().Add(-1 * time.Hour)
+	v1 := testhelpers.NewFakePrometheus(fmt.Sprintf(`prometheus_build_info{version="1.8.2"} 1
+process_start_time_seconds %d
+prometheus_local_storage_ingested_samples_total 150000
+`, started.Unix()), nil)
+	defer v1.Close()
+
+	// 100000 samples appended within the last hour, with 2 hours of retained data
+	v2 := testhelpers.NewFakePrometheus(fmt.Sprintf(`prometheus_build_info{version="2.3.1"} 1
+process_start_time_seconds %d
+prometheus_tsdb_head_samples_appended_total 100000
+prometheus_tsdb_lowest_timestamp %d
+`, started.Unix(), started.Add(-1*time.Hour).Unix()*1000), nil)
+	defer v2.Close()
+
+	v2NoRetention := testhelpers.NewFakePrometheus(`prometheus_build_info{version="2.0.0"} 1
+prometheus_tsdb_head_samples_appended_total 120000
+`, nil)
+	defer v2NoRetention.Close()
+
+	unknown := testhelpers.NewFakePrometheus(`prometheus_build_info{version="2.0.0"} 1
+`, nil)
+	defer unknown.Close()
+
+	endpoints, err := locator.ToPrometheusClients([]string{v1.URL, v2.URL, v2NoRetention.URL, unknown.URL})
+	assert.Nil(t, err)
+
+	err = (&Selector{}).Select(endpoints)
+	assert.Nil(t, err)
+
+	assert.False(t, endpoints[0].Selected)
+	assert.Equal(t, int64(150000), endpoints[0].ComparisonMetricValue)
+	assert.Equal(t, ingestedSamplesMetricName, endpoints[0].ComparisonMetricName)
+
+	assert.True(t, endpoints[1].Selected)
+	assert.InDelta(t, 200000, endpoints[1].ComparisonMetricValue, 1000)
+	assert.Contains(t, endpoints[1].ComparisonMetricName, appendedSamplesMetricName)
+
+	assert.False(t, endpoints[2].Selected)
+	assert.Equal(t, int64(120000), endpoints[2].ComparisonMetricValue)
+	assert.Equal(t, appendedSamplesMetricName, endpoints[2].ComparisonMetricName)
+
+	assert.False(t, endpoints[3].Selected)
+	assert.NotNil(t, endpoints[3].Error)
+}
+
+func TestSelectComparesWithinMajorVersion(t *testing.T) {
+	v1 := testhelpers.NewFakePrometheus(`prometheus_build_info{version="1.8.2"} 1
+prometheus_local_storage_ingested_samples_total 1000000
+`, nil)
+	defer v1.Close()
+
+	v2 := testhelpers.NewFakePrometheus(`prometheus_build_info{version="2.3.1"} 1
+prometheus_tsdb_head_samples_appended_total 100000
+`, nil)
+	defer v2.Close()
+
+	endpoints, err := locator.ToPrometheusClients([]string{v1.URL, v2.URL})
+	assert.Nil(t, err)
+
+	// the 1.x endpoint has more samples, but is not compared with the 2.x endpoint
+	assert.Nil(t, (&Selector{}).Select(endpoints))
+	assert.False(t, endpoints[0].Selected)
+	assert.Equal(t, int64(1000000), endpoints[0].ComparisonMetricValue)
+	assert.True(t, endpoints[1].Selected)
+
+	// the 1.x endpoints are compared when no 2.x endpoint is available
+	assert.Nil(t, (&Selector{}).Select(endpoints[:1]))
+	assert.True(t, endpoints[0].Selected)
+}
@@ -0,0 +1,4 @@
+// Package version implements target selection for multi-prometheus deployments by
+// restricting selection to instances running a single version of prometheus, so that
+// queries are not answered by a mix of versions during rolling upgrades
+package version // import "github.com/matt-deboer/mpp/pkg/selector/strategy/version"
@@ -0,0 +1,198 @@
+package version
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// semver is a parsed (semantic) version of prometheus, such as '2.4.0-rc.0'
+type semver struct {
+	major, minor, patch int
+	prerelease          string
+}
+
+// parseVersion parses a version of the form '[v]{major}.{minor}.{patch}[-{prerelease}][+{build}]'
+func parseVersion(value string) (*semver, error) {
+	v, parts, err := parseParts(value)
+	if err != nil {
+		return nil, err
+	}
+	if parts < 3 {
+		return nil, fmt.Errorf("Invalid version '%s'", value)
+	}
+	return v, nil
+}
+
+// parseParts parses a version which may be partial (e.g., '2.4') or end with a wildcard (e.g., '2.x'),
+// returning the number of parts specified
+func parseParts(value string) (*semver, int, error) {
+	s := strings.TrimPrefix(strings.TrimSpace(value), "v")
+	if i := strings.Index(s, "+"); i >= 0 {
+		s = s[:i]
+	}
+	v := &semver{}
+	if i := strings.Index(s, "-"); i >= 0 {
+		v.prerelease = s[i+1:]
+		s = s[:i]
+	}
+	fields := strings.Split(s, ".")
+	if len(fields) > 3 {
+		return nil, 0, fmt.Errorf("Invalid version '%s'", value)
+	}
+	numbers := []*int{&v.major, &v.minor, &v.patch}
+	parts := 0
+	for i, field := range fields {
+		if field == "x" || field == "X" || field == "*" {
+			break
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return nil, 0, fmt.Errorf("Invalid version '%s'", value)
+		}
+		*numbers[i] = n
+		parts++
+	}
+	if parts < 3 && len(v.prerelease) > 0 {
+		return nil, 0, fmt.Errorf("Invalid version '%s'", value)
+	}
+	return v, parts, nil
+}
+
+func (v *semver) String() string {
+	if len(v.prerelease) > 0 {
+		return fmt.Sprintf("%d.%d.%d-%s", v.major, v.minor, v.patch, v.prerelease)
+	}
+	return fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+}
+
+// compare returns -1, 0 or 1 when v is older than, the same as, or newer than other;
+// pre-releases are older than the corresponding release
+func (v *semver) compare(other *semver) int {
+	for _, d := range []int{v.major - other.major, v.minor - other.minor, v.patch - other.patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+	switch {
+	case v.prerelease == other.prerelease:
+		return 0
+	case len(v.prerelease) == 0:
+		return 1
+	case len(other.prerelease) == 0:
+		return -1
+	}
+	return comparePrerelease(v.prerelease, other.prerelease)
+}
+
+// comparePrerelease compares pre-release identifiers, numerically where both are numeric
+func comparePrerelease(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				return sign(an - bn)
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		case as[i] != bs[i]:
+			return sign(strings.Compare(as[i], bs[i]))
+		}
+	}
+	return sign(len(as) - len(bs))
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// constraint bounds a version, as in '>=2.3.0'
+type constraint struct {
+	op      string
+	version *semver
+}
+
+func (c *constraint) matches(v *semver) bool {
+	d := v.compare(c.version)
+	switch c.op {
+	case ">":
+		return d > 0
+	case ">=":
+		return d >= 0
+	case "<":
+		return d < 0
+	case "<=":
+		return d <= 0
+	}
+	return d == 0
+}
+
+// versionRange is a set of constraints, all of which a version must satisfy
+type versionRange struct {
+	spec        string
+	constraints []*constraint
+}
+
+// parseRange parses a space-separated list of constraints, each of which is a version prefixed by one
+// of '>', '>=', '<', '<=' or '='; a version without an operator (or with '=') may be partial or end
+// in a wildcard, as in '2.4' or '2.x', and '~{version}' and '^{version}' allow patch and minor updates
+func parseRange(spec string) (*versionRange, error) {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("Empty version range")
+	}
+	r := &versionRange{spec: spec}
+	for _, field := range fields {
+		value := strings.TrimLeft(field, "<>=~^")
+		op := field[:len(field)-len(value)]
+		v, parts, err := parseParts(value)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case ">", ">=", "<", "<=":
+			if parts == 0 {
+				return nil, fmt.Errorf("Invalid version constraint '%s'", field)
+			}
+			r.constraints = append(r.constraints, &constraint{op, v})
+		case "", "=", "~", "^":
+			if parts == 0 {
+				// matches any version
+				continue
+			}
+			if parts == 3 && (op == "" || op == "=") {
+				r.constraints = append(r.constraints, &constraint{"=", v})
+				continue
+			}
+			// the upper bound excludes pre-releases of the next version
+			upper := &semver{major: v.major, minor: v.minor + 1, prerelease: "0"}
+			if parts == 1 || (op == "^" && v.major > 0) {
+				upper.major, upper.minor = v.major+1, 0
+			}
+			r.constraints = append(r.constraints, &constraint{">=", v}, &constraint{"<", upper})
+		default:
+			return nil, fmt.Errorf("Invalid version constraint '%s'", field)
+		}
+	}
+	return r, nil
+}
+
+func (r *versionRange) matches(v *semver) bool {
+	for _, c := range r.constraints {
+		if !c.matches(v) {
+			return false
+		}
+	}
+	return true
+}
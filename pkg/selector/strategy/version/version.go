@@ -0,0 +1,170 @@
+package version
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/matt-deboer/mpp/pkg/selector"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	baseName = "version"
+	newest   = "newest"
+	oldest   = "oldest"
+)
+
+func init() {
+	rand.Seed(time.Now().UTC().UnixNano())
+	selector.RegisterStrategy(baseName, func(args ...string) (selector.Strategy, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("Strategy %s requires a single {newest|oldest|range} argument", baseName)
+		}
+		return NewSelector(args[0])
+	})
+}
+
+// Selector implements selection of the prometheus endpoints running a single version of prometheus:
+// the newest or oldest version amongst the viable endpoints, or the newest version within a range
+type Selector struct {
+	mode         string
+	versionRange *versionRange
+	mutex        sync.Mutex
+	spread       string
+}
+
+// NewSelector creates a version strategy, choosing the 'newest' or 'oldest' version, or the
+// newest version within a range such as '>=2.3.0 <2.5.0' or '2.4.x'
+func NewSelector(mode string) (*Selector, error) {
+	s := &Selector{mode: strings.TrimSpace(mode)}
+	if s.mode != newest && s.mode != oldest {
+		r, err := parseRange(s.mode)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid argument '%s' for %s; must be 'newest', 'oldest' or a version range: %v", mode, baseName, err)
+		}
+		s.versionRange = r
+	}
+	return s, nil
+}
+
+// Name provides the (unique) name of this strategy
+func (s *Selector) Name() string {
+	return fmt.Sprintf("%s:%s", baseName, s.mode)
+}
+
+// Description provides a human-readable description for this strategy
+func (s *Selector) Description() string {
+	if s.versionRange != nil {
+		return fmt.Sprintf("Selects a prometheus instance at random from those running the newest version matching '%s'", s.mode)
+	}
+	return fmt.Sprintf("Selects a prometheus instance at random from those running the %s version", s.mode)
+}
+
+// ComparisonMetricName gets the name of the comparison metric/calculation used to make a selection
+func (s *Selector) ComparisonMetricName() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.spread) == 0 {
+		return "version"
+	}
+	return fmt.Sprintf("version (spread: %s)", s.spread)
+}
+
+// RequiresStickySessions answers whether this strategy needs sticky sessions
+func (s *Selector) RequiresStickySessions() bool {
+	return true
+}
+
+// NextIndex returns the index of the target that should be used to field the next request
+func (s *Selector) NextIndex(targets []*url.URL) int {
+	next := rand.Intn(len(targets))
+	if log.GetLevel() >= log.DebugLevel {
+		log.Debugf("Strategy %T returned next index: %d", s, next)
+	}
+	return next
+}
+
+// Select chooses elligible prometheus endpoints out of the provided set
+func (s *Selector) Select(endpoints []*locator.PrometheusEndpoint) (err error) {
+	versions := make([]*semver, len(endpoints))
+	counts := make(map[string]int)
+	var chosen *semver
+	for i, endpoint := range endpoints {
+		endpoint.Selected = false
+		if endpoint.QueryAPI == nil {
+			continue
+		}
+		v, err := endpointVersion(endpoint)
+		if err != nil {
+			log.Errorf("Endpoint %v returned error: %v", endpoint, err)
+			endpoint.Error = err
+			continue
+		}
+		endpoint.ComparisonMetricValue = v.String()
+		if !endpoint.Viable() {
+			continue
+		}
+		versions[i] = v
+		counts[v.String()]++
+		if s.versionRange != nil && !s.versionRange.matches(v) {
+			continue
+		}
+		if chosen == nil || (s.mode == oldest && v.compare(chosen) < 0) || (s.mode != oldest && v.compare(chosen) > 0) {
+			chosen = v
+		}
+	}
+
+	s.mutex.Lock()
+	s.spread = describeSpread(counts)
+	s.mutex.Unlock()
+
+	if chosen == nil {
+		return fmt.Errorf("No valid/responding endpoints found in the provided list: %v", endpoints)
+	}
+	for i, v := range versions {
+		if v != nil && v.compare(chosen) == 0 {
+			endpoints[i].Selected = true
+		} else if v != nil && log.GetLevel() >= log.DebugLevel {
+			log.Debugf("Excluding endpoint %v, which is running version %s rather than %s", endpoints[i], v, chosen)
+		}
+	}
+	return nil
+}
+
+// endpointVersion determines the version of prometheus from the endpoint's 'prometheus_build_info'
+func endpointVersion(endpoint *locator.PrometheusEndpoint) (*semver, error) {
+	buildInfo, err := endpoint.Metric("prometheus_build_info")
+	if err == nil && buildInfo == nil {
+		err = fmt.Errorf("Metric prometheus_build_info was not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	v, err := parseVersion(buildInfo.Label("version"))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse prometheus version: %v", err)
+	}
+	return v, nil
+}
+
+// describeSpread lists the versions of the viable endpoints, oldest first, with the number of
+// endpoints running each, e.g. '2.3.1 (2), 2.4.0 (1)'
+func describeSpread(counts map[string]int) string {
+	var versions []*semver
+	for value := range counts {
+		v, _ := parseVersion(value)
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].compare(versions[j]) < 0 })
+	var parts []string
+	for _, v := range versions {
+		parts = append(parts, fmt.Sprintf("%s (%d)", v, counts[v.String()]))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,89 @@
+package version
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/matt-deboer/mpp/pkg/selector"
+	"github.com/matt-deboer/mpp/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectSingleVersion(t *testing.T) {
+	var addrs []string
+	for _, version := range []string{"2.3.1", "2.4.0-rc.0", "2.4.0", "1.8.2", "2.3.1", ""} {
+		var metrics string
+		if len(version) > 0 {
+			metrics = fmt.Sprintf("prometheus_build_info{version=%q} 1\n", version)
+		}
+		server := testhelpers.NewFakePrometheus(metrics, nil)
+		defer server.Close()
+		addrs = append(addrs, server.URL)
+	}
+
+	selected := func(arg string) []bool {
+		endpoints, err := locator.ToPrometheusClients(addrs)
+		assert.Nil(t, err)
+		s, err := selector.NewSelector(nil, baseName, arg)
+		assert.Nil(t, err)
+		assert.Nil(t, s.Strategy.Select(endpoints))
+		assert.NotNil(t, endpoints[5].Error)
+		assert.Equal(t, "version (spread: 1.8.2 (1), 2.3.1 (2), 2.4.0-rc.0 (1), 2.4.0 (1))", s.Strategy.ComparisonMetricName())
+		result := make([]bool, len(endpoints))
+		for i, endpoint := range endpoints {
+			result[i] = endpoint.Selected
+		}
+		return result
+	}
+
+	assert.Equal(t, []bool{false, false, true, false, false, false}, selected("newest"))
+	assert.Equal(t, []bool{false, false, false, true, false, false}, selected("oldest"))
+	// pre-releases precede their release
+	assert.Equal(t, []bool{false, true, false, false, false, false}, selected("<2.4.0"))
+	assert.Equal(t, []bool{true, false, false, false, true, false}, selected("<2.4.0-0"))
+	assert.Equal(t, []bool{true, false, false, false, true, false}, selected("~2.3"))
+	assert.Equal(t, []bool{false, true, false, false, false, false}, selected(">=2.4.0-0 <2.4.0"))
+	assert.Equal(t, []bool{false, false, true, false, false, false}, selected("2.x"))
+	assert.Equal(t, []bool{false, false, false, true, false, false}, selected("1"))
+
+	endpoints, err := locator.ToPrometheusClients(addrs)
+	assert.Nil(t, err)
+	s, err := NewSelector("3.x")
+	assert.Nil(t, err)
+	assert.NotNil(t, s.Select(endpoints))
+
+	for _, args := range [][]string{{}, {"latest"}, {">=x"}, {"2.3.x-rc"}, {"2.3.1.4"}} {
+		_, err := selector.NewSelector(nil, append([]string{baseName}, args...)...)
+		assert.NotNil(t, err, "Expected an error for %v", args)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	ordered := []string{"1.8.2", "2.0.0-beta.2", "2.0.0-beta.10", "2.0.0-rc.0", "2.0.0", "v2.0.1+build", "2.10.0"}
+	for i := 1; i < len(ordered); i++ {
+		a, err := parseVersion(ordered[i-1])
+		assert.Nil(t, err)
+		b, err := parseVersion(ordered[i])
+		assert.Nil(t, err)
+		assert.Equal(t, -1, a.compare(b), "Expected %s < %s", a, b)
+		assert.Equal(t, 1, b.compare(a), "Expected %s > %s", b, a)
+	}
+
+	for spec, expected := range map[string][]bool{
+		"^2.3":   {false, false, false, true, false, false},
+		"^0.3.1": {false, false, false, false, false, false},
+		"~2.0.0": {false, false, false, false, true, false},
+		"=2.0":   {false, false, false, false, true, false},
+		"*":      {true, true, true, true, true, true},
+	} {
+		r, err := parseRange(spec)
+		assert.Nil(t, err)
+		var matches []bool
+		for _, value := range []string{"1.8.2", "2.0.0-rc.0", "2.3.0-rc.1", "2.3.0", "2.0.1", "3.0.0-rc.0"} {
+			v, _ := parseVersion(value)
+			matches = append(matches, r.matches(v))
+		}
+		assert.Equal(t, expected, matches, "Unexpected matches for '%s'", spec)
+	}
+}
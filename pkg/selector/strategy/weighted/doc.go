@@ -0,0 +1,3 @@
+// Package weighted implements target selection for multi-prometheus deployments
+// by choosing amongst all viable instances at random, in proportion to their weights
+package weighted // import "github.com/matt-deboer/mpp/pkg/selector/strategy/weighted"
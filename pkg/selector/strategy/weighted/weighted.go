@@ -0,0 +1,88 @@
+package weighted
+
+import (
+	"math/rand"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/matt-deboer/mpp/pkg/selector"
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	selector.RegisterStrategy("weighted", func(args ...string) (selector.Strategy, error) {
+		return NewSelector(), nil
+	})
+}
+
+// Selector implements selection of all viable prometheus endpoints, choosing amongst them
+// at random for each new session, with a probability proportional to their weights
+type Selector struct {
+	mutex   sync.Mutex
+	weights map[string]float64
+	random  *rand.Rand
+}
+
+// NewSelector creates a weighted strategy
+func NewSelector() *Selector {
+	return &Selector{
+		weights: make(map[string]float64),
+		random:  rand.New(rand.NewSource(time.Now().UTC().UnixNano())),
+	}
+}
+
+// Name provides the (unique) name of this strategy
+func (s *Selector) Name() string {
+	return "weighted"
+}
+
+// Description provides a human-readable description for this strategy
+func (s *Selector) Description() string {
+	return "Selects a prometheus instance at random, in proportion to its weight"
+}
+
+// ComparisonMetricName gets the name of the comparison metric/calculation used to make a selection
+func (s *Selector) ComparisonMetricName() string {
+	return "weight"
+}
+
+// RequiresStickySessions answers whether this strategy needs sticky sessions
+func (s *Selector) RequiresStickySessions() bool {
+	return true
+}
+
+// NextIndex returns the index of the target that should be used to field the next request
+func (s *Selector) NextIndex(targets []*url.URL) int {
+	if len(targets) < 2 {
+		return 0
+	}
+	s.mutex.Lock()
+	weights, total := locator.TargetWeights(s.weights, targets)
+	r := s.random.Float64() * total
+	s.mutex.Unlock()
+
+	next := len(targets) - 1
+	for i, weight := range weights {
+		if r < weight {
+			next = i
+			break
+		}
+		r -= weight
+	}
+	if log.GetLevel() >= log.DebugLevel {
+		log.Debugf("Strategy %T returned next index: %d", s, next)
+	}
+	return next
+}
+
+// Select chooses elligible prometheus endpoints out of the provided set; endpoints with
+// a weight of 0 are considered to be drained, and are not selected
+func (s *Selector) Select(endpoints []*locator.PrometheusEndpoint) error {
+	weights, err := locator.SelectWeighted(endpoints)
+	s.mutex.Lock()
+	s.weights = weights
+	s.mutex.Unlock()
+	return err
+}
@@ -0,0 +1,42 @@
+package weighted
+
+import (
+	"math/rand"
+	"net/url"
+	"testing"
+
+	"github.com/matt-deboer/mpp/pkg/selector"
+	"github.com/stretchr/testify/assert"
+)
+
+// fixedSource produces random numbers for which rand.Float64 returns the provided values in turn
+type fixedSource []float64
+
+func (s *fixedSource) Int63() int64 {
+	value := (*s)[0]
+	*s = (*s)[1:]
+	return int64(value * (1 << 63))
+}
+
+func (s *fixedSource) Seed(seed int64) {}
+
+func TestWeightedSelection(t *testing.T) {
+	sel, err := selector.NewSelector(nil, "weighted")
+	assert.Nil(t, err)
+	s := sel.Strategy.(*Selector)
+	s.weights = map[string]float64{"http://a:9090": 9}
+	s.random = rand.New(&fixedSource{0, 0.05, 0.89, 0.91, 0.99})
+
+	var targets []*url.URL
+	for _, addr := range []string{"http://a:9090", "http://b:9090"} {
+		u, _ := url.Parse(addr)
+		targets = append(targets, u)
+	}
+	var order []int
+	for i := 0; i < 5; i++ {
+		order = append(order, s.NextIndex(targets))
+	}
+	// targets are chosen in proportion to their weights, of 9 and 1
+	assert.Equal(t, []int{0, 0, 0, 1, 1}, order)
+	assert.Equal(t, 0, s.NextIndex(targets[1:2]))
+}
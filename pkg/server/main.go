@@ -9,12 +9,24 @@ import (
 	"net/http"
 
 	"github.com/matt-deboer/mpp/pkg/locator"
+	"github.com/matt-deboer/mpp/pkg/locator/consullocator"
+	"github.com/matt-deboer/mpp/pkg/locator/dnslocator"
+	"github.com/matt-deboer/mpp/pkg/locator/httpsdlocator"
 	"github.com/matt-deboer/mpp/pkg/locator/kuberneteslocator"
 	"github.com/matt-deboer/mpp/pkg/locator/marathonlocator"
 	"github.com/matt-deboer/mpp/pkg/router"
+	"github.com/matt-deboer/mpp/pkg/selector"
+	_ "github.com/matt-deboer/mpp/pkg/selector/strategy/expression"
+	_ "github.com/matt-deboer/mpp/pkg/selector/strategy/freshness"
+	_ "github.com/matt-deboer/mpp/pkg/selector/strategy/gapaware"
+	_ "github.com/matt-deboer/mpp/pkg/selector/strategy/leastlatency"
 	_ "github.com/matt-deboer/mpp/pkg/selector/strategy/minimumhistory"
+	_ "github.com/matt-deboer/mpp/pkg/selector/strategy/preferred"
 	_ "github.com/matt-deboer/mpp/pkg/selector/strategy/random"
+	_ "github.com/matt-deboer/mpp/pkg/selector/strategy/roundrobin"
 	_ "github.com/matt-deboer/mpp/pkg/selector/strategy/singlemostdata"
+	_ "github.com/matt-deboer/mpp/pkg/selector/strategy/version"
+	_ "github.com/matt-deboer/mpp/pkg/selector/strategy/weighted"
 	"github.com/matt-deboer/mpp/pkg/version"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
@@ -41,13 +53,15 @@ func main() {
 			EnvVar: "MPP_KUBE_SERVICE_NAME",
 		},
 		cli.StringFlag{
-			Name:   "kube-pod-label-selector",
-			Usage:  `The label selector used to find prometheus pods`,
+			Name: "kube-pod-label-selector",
+			Usage: `The label selector used to find prometheus pods; supports the full kubernetes selector syntax,
+				e.g. 'app=prometheus,tier in (primary, secondary),!canary'`,
 			EnvVar: "MPP_KUBE_POD_LABEL_SELECTOR",
 		},
 		cli.StringFlag{
-			Name:   "kube-namespace",
-			Usage:  `The namespace in which prometheus pods/endpoints exist`,
+			Name: "kube-namespace",
+			Usage: `A comma-separated list of namespaces in which prometheus pods/endpoints exist;
+				use '*' to search all namespaces`,
 			Value:  "default",
 			EnvVar: "MPP_KUBE_NAMESPACE",
 		},
@@ -64,7 +78,8 @@ func main() {
 		cli.StringFlag{
 			Name: "marathon-apps",
 			Usage: `A comma-separated list of marathon app IDs whose tasks will be queried for
-				prometheus endpoints`,
+				prometheus endpoints, in the form '{appID}[:{portName|portIndex}]'; the app ID may be a group
+				wildcard such as '/monitoring/*'`,
 			EnvVar: "MPP_MARATHON_APPS",
 		},
 		cli.StringFlag{
@@ -83,16 +98,90 @@ func main() {
 				contained within the secret`,
 			EnvVar: "MPP_MARATHON_AUTH_ENDPOINT",
 		},
+		cli.StringFlag{
+			Name: "dns-srv-names",
+			Usage: `A comma-separated list of DNS SRV record names (e.g., '_web._tcp.prometheus.svc') which will be
+				resolved to locate prometheus instances`,
+			EnvVar: "MPP_DNS_SRV_NAMES",
+		},
+		cli.StringFlag{
+			Name: "dns-a-names",
+			Usage: `A comma-separated list of DNS A/AAAA record names with port (e.g., 'prometheus.svc:9090') which will be
+				resolved to locate prometheus instances`,
+			EnvVar: "MPP_DNS_A_NAMES",
+		},
+		cli.StringFlag{
+			Name: "dns-resolver",
+			Usage: `The address ('host:port') of the DNS server used to resolve 'dns-srv-names' and 'dns-a-names';
+				if not specified, the system resolver is used`,
+			EnvVar: "MPP_DNS_RESOLVER",
+		},
+		cli.StringFlag{
+			Name:   "dns-scheme",
+			Usage:  `The scheme used for prometheus endpoints located via DNS`,
+			Value:  "http",
+			EnvVar: "MPP_DNS_SCHEME",
+		},
+		cli.BoolFlag{
+			Name: "dns-resolve-srv-targets",
+			Usage: `Whether the target hosts of 'dns-srv-names' are resolved to their addresses using 'dns-resolver', rather
+				than used as-is; ignored for the https scheme`,
+			EnvVar: "MPP_DNS_RESOLVE_SRV_TARGETS",
+		},
+		cli.StringFlag{
+			Name:   "consul-url",
+			Usage:  `The URL of the consul agent used to locate prometheus instances`,
+			EnvVar: "MPP_CONSUL_URL",
+		},
+		cli.StringFlag{
+			Name:   "consul-service",
+			Usage:  `The name of the consul service whose instances are prometheus endpoints`,
+			EnvVar: "MPP_CONSUL_SERVICE",
+		},
+		cli.StringFlag{
+			Name:   "consul-tag",
+			Usage:  `A tag used to filter the instances of 'consul-service'`,
+			EnvVar: "MPP_CONSUL_TAG",
+		},
+		cli.StringFlag{
+			Name:   "consul-datacenter",
+			Usage:  `The consul datacenter to query; if not specified, the datacenter of the agent is used`,
+			EnvVar: "MPP_CONSUL_DATACENTER",
+		},
+		cli.StringFlag{
+			Name:   "consul-token",
+			Usage:  `The ACL token used to authenticate with consul`,
+			EnvVar: "MPP_CONSUL_TOKEN",
+		},
+		cli.StringFlag{
+			Name:   "consul-scheme",
+			Usage:  `The scheme used for prometheus endpoints located via consul`,
+			Value:  "http",
+			EnvVar: "MPP_CONSUL_SCHEME",
+		},
+		cli.StringFlag{
+			Name: "http-sd-url",
+			Usage: `The URL of an endpoint serving target groups in the format of prometheus' http_sd_configs, which
+				is fetched to locate prometheus instances`,
+			EnvVar: "MPP_HTTP_SD_URL",
+		},
+		cli.StringFlag{
+			Name:   "http-sd-authorization",
+			Usage:  `The value of the 'Authorization' header sent to 'http-sd-url' (e.g., 'Bearer {token}')`,
+			EnvVar: "MPP_HTTP_SD_AUTHORIZATION",
+		},
 		cli.StringFlag{
 			Name: "endpoints-file",
-			Usage: `A file path containing a list of endpoints to use, one per line. This file is re-read at every
-				selection interval`,
+			Usage: `A file path containing a list of endpoints to use, one per line; files ending in '.json', '.yml' or
+				'.yaml' are read as prometheus file_sd_configs target groups. This file is watched for changes, triggering
+				an immediate selection`,
 			EnvVar: "MPP_ENDPOINTS_FILE",
 		},
 		cli.StringFlag{
 			Name: "routing-strategy",
 			Usage: `The strategy to use for choosing viable prometheus enpoint(s) from those located;
-				valid choices include: 'single-most-data', 'random', 'minimum-history'`,
+				valid choices include: 'single-most-data', 'random', 'minimum-history', 'expression', 'freshness', 'gap-aware', 'preferred', 'least-latency', 'round-robin', 'weighted', 'version';
+				strategies may be combined as 'chain({strategy},{strategy},...)'`,
 			Value:  "single-most-data",
 			EnvVar: "MPP_ROUTING_STRATEGY",
 		},
@@ -103,6 +192,99 @@ func main() {
 			Value:  "10s",
 			EnvVar: "MPP_SELECTION_INTERVAL",
 		},
+		cli.Float64Flag{
+			Name: "selection-margin",
+			Usage: `When a strategy selects a single endpoint, retain the current selection unless another endpoint beats
+				it by more than this ratio of its comparison metric value (e.g., 0.05 for 5%); 0 disables the margin`,
+			EnvVar: "MPP_SELECTION_MARGIN",
+		},
+		cli.IntFlag{
+			Name: "selection-rounds",
+			Usage: `When a strategy selects a single endpoint, retain the current selection unless another endpoint
+				is chosen for this many consecutive selections; 0 disables the rounds`,
+			EnvVar: "MPP_SELECTION_ROUNDS",
+		},
+		cli.Float64Flag{
+			Name: "outlier-error-ratio",
+			Usage: `Eject a selected backend from the selection when this ratio of its responses within 'outlier-window'
+				are 5xx errors (e.g., 0.5); 0 disables ejection by error ratio`,
+			EnvVar: "MPP_OUTLIER_ERROR_RATIO",
+		},
+		cli.StringFlag{
+			Name: "outlier-latency",
+			Usage: `Eject a selected backend from the selection when its mean response latency within 'outlier-window'
+				reaches this duration (e.g., 30s); 0 disables ejection by latency`,
+			Value:  "0s",
+			EnvVar: "MPP_OUTLIER_LATENCY",
+		},
+		cli.StringFlag{
+			Name:   "outlier-window",
+			Usage:  `The sliding window over which the error ratio and latency of each backend are measured`,
+			Value:  "30s",
+			EnvVar: "MPP_OUTLIER_WINDOW",
+		},
+		cli.IntFlag{
+			Name:   "outlier-min-requests",
+			Usage:  `The number of requests a backend must receive within 'outlier-window' before it may be ejected`,
+			Value:  10,
+			EnvVar: "MPP_OUTLIER_MIN_REQUESTS",
+		},
+		cli.StringFlag{
+			Name: "outlier-ejection-time",
+			Usage: `The period for which an outlier is first ejected; the period doubles with each consecutive ejection
+				of the same backend, up to 'outlier-max-ejection-time'`,
+			Value:  "30s",
+			EnvVar: "MPP_OUTLIER_EJECTION_TIME",
+		},
+		cli.StringFlag{
+			Name:   "outlier-max-ejection-time",
+			Usage:  `The maximum period for which an outlier is ejected`,
+			Value:  "5m",
+			EnvVar: "MPP_OUTLIER_MAX_EJECTION_TIME",
+		},
+		cli.Float64Flag{
+			Name:   "outlier-max-ejected-ratio",
+			Usage:  `The maximum ratio of the selected backends which may be ejected at once`,
+			Value:  0.5,
+			EnvVar: "MPP_OUTLIER_MAX_EJECTED_RATIO",
+		},
+		cli.IntFlag{
+			Name: "breaker-consecutive-failures",
+			Usage: `Open the circuit breaker of a backend, stopping requests to it, after this many consecutive
+				5xx responses; 0 disables tripping by consecutive failures`,
+			EnvVar: "MPP_BREAKER_CONSECUTIVE_FAILURES",
+		},
+		cli.Float64Flag{
+			Name: "breaker-error-ratio",
+			Usage: `Open the circuit breaker of a backend when this ratio of its responses within 'breaker-window'
+				are 5xx errors (e.g., 0.5); 0 disables tripping by error ratio`,
+			EnvVar: "MPP_BREAKER_ERROR_RATIO",
+		},
+		cli.StringFlag{
+			Name:   "breaker-window",
+			Usage:  `The sliding window over which the error ratio of each backend is measured for its circuit breaker`,
+			Value:  "10s",
+			EnvVar: "MPP_BREAKER_WINDOW",
+		},
+		cli.IntFlag{
+			Name:   "breaker-min-requests",
+			Usage:  `The number of requests a backend must receive within 'breaker-window' to trip its breaker by error ratio`,
+			Value:  10,
+			EnvVar: "MPP_BREAKER_MIN_REQUESTS",
+		},
+		cli.StringFlag{
+			Name:   "breaker-open-time",
+			Usage:  `The period for which an open circuit breaker stops requests, before it becomes half-open`,
+			Value:  "10s",
+			EnvVar: "MPP_BREAKER_OPEN_TIME",
+		},
+		cli.IntFlag{
+			Name: "breaker-probe-requests",
+			Usage: `The number of requests allowed through a half-open circuit breaker, all of which must succeed
+				for the breaker to close`,
+			Value:  3,
+			EnvVar: "MPP_BREAKER_PROBE_REQUESTS",
+		},
 		cli.StringFlag{
 			Name: "affinity-options",
 			Usage: `A comma-separated list of sticky-session modes to enable, of which 'cookies', and 'sourceip' 
@@ -134,7 +316,31 @@ func main() {
 		locators := parseLocators(c)
 		affinityOptions := parseAffinityOptions(c)
 
-		router, err := router.NewRouter(interval, affinityOptions,
+		stability := selector.Stability{
+			Margin: c.Float64("selection-margin"),
+			Rounds: c.Int("selection-rounds"),
+		}
+
+		outlierDetection := router.OutlierDetection{
+			ErrorRatio:      c.Float64("outlier-error-ratio"),
+			Latency:         parseDuration(c, "outlier-latency"),
+			Window:          parseDuration(c, "outlier-window"),
+			MinRequests:     c.Int("outlier-min-requests"),
+			EjectionTime:    parseDuration(c, "outlier-ejection-time"),
+			MaxEjectionTime: parseDuration(c, "outlier-max-ejection-time"),
+			MaxEjectedRatio: c.Float64("outlier-max-ejected-ratio"),
+		}
+
+		circuitBreaker := router.CircuitBreaker{
+			ConsecutiveFailures: c.Int("breaker-consecutive-failures"),
+			ErrorRatio:          c.Float64("breaker-error-ratio"),
+			Window:              parseDuration(c, "breaker-window"),
+			MinRequests:         c.Int("breaker-min-requests"),
+			OpenTime:            parseDuration(c, "breaker-open-time"),
+			ProbeRequests:       c.Int("breaker-probe-requests"),
+		}
+
+		router, err := router.NewRouter(interval, affinityOptions, stability, outlierDetection, circuitBreaker,
 			locators, strings.Split(strategy, ":")...)
 		if err != nil {
 			log.Fatal(err)
@@ -179,22 +385,54 @@ func parseLocators(c *cli.Context) []locator.Locator {
 	insecure := c.Bool("insecure-certs")
 	endpointsFile := c.String("endpoints-file")
 	kubeconfig := c.String("kubeconfig")
-	kubeNamespace := c.String("kube-namespace")
+	kubeNamespaces := splitList(c.String("kube-namespace"))
 	kubeServiceName := c.String("kube-service-name")
 	kubePodLabelSelector := c.String("kube-pod-label-selector")
 	marathonURL := c.String("marathon-url")
+	dnsSRVNames := splitList(c.String("dns-srv-names"))
+	dnsANames := splitList(c.String("dns-a-names"))
+	consulURL := c.String("consul-url")
+	httpSDURL := c.String("http-sd-url")
+
+	locator.SetInsecureCerts(insecure)
 
 	if len(endpointsFile) > 0 {
 		locators = append(locators, locator.NewEndpointsFileLocator(endpointsFile))
 	}
 
+	if len(dnsSRVNames) > 0 || len(dnsANames) > 0 {
+		locator, err := dnslocator.NewDNSLocator(dnsSRVNames, dnsANames,
+			c.String("dns-resolver"), c.String("dns-scheme"), c.Bool("dns-resolve-srv-targets"))
+		if err != nil {
+			argError(c, "Failed to create DNS locator: %v", err)
+		}
+		locators = append(locators, locator)
+	}
+
+	if len(httpSDURL) > 0 {
+		locator, err := httpsdlocator.NewHTTPSDLocator(httpSDURL, c.String("http-sd-authorization"), insecure)
+		if err != nil {
+			argError(c, "Failed to create http service-discovery locator: %v", err)
+		}
+		locators = append(locators, locator)
+	}
+
+	if len(consulURL) > 0 {
+		locator, err := consullocator.NewConsulLocator(consulURL, c.String("consul-service"), c.String("consul-tag"),
+			c.String("consul-datacenter"), c.String("consul-token"), c.String("consul-scheme"), insecure)
+		if err != nil {
+			argError(c, "Failed to create consul locator: %v", err)
+		}
+		locators = append(locators, locator)
+	}
+
 	if len(kubeServiceName) > 0 || len(kubePodLabelSelector) > 0 {
-		if len(kubeNamespace) == 0 {
+		if len(kubeNamespaces) == 0 {
 			argError(c, `--kube-namespace is required when using the kubernetes locator`)
 		}
 		kubePort := c.String("kube-port")
 		locator, err := kuberneteslocator.NewKubernetesLocator(kubeconfig,
-			kubeNamespace, kubePodLabelSelector, kubePort, kubeServiceName)
+			kubeNamespaces, kubePodLabelSelector, kubePort, kubeServiceName)
 		if err != nil {
 			log.Fatalf("Failed to create kubernetes locator: %v", err)
 		}
@@ -206,7 +444,7 @@ func parseLocators(c *cli.Context) []locator.Locator {
 		if len(marathonAppsString) == 0 {
 			argError(c, "'marathon-apps' is required when 'marathon-url' is specified")
 		}
-		marathonApps := strings.Split(marathonAppsString, ",")
+		marathonApps := splitList(marathonAppsString)
 		marathonPrincipalSecret := c.String("marathon-principal-secret")
 		marathonAuthEndpoint := c.String("marathon-auth-endpoint")
 		locator, err := marathonlocator.NewMarathonLocator(marathonURL,
@@ -218,12 +456,23 @@ func parseLocators(c *cli.Context) []locator.Locator {
 	}
 	if len(locators) == 0 {
 		argError(c, `At least one locator mechanism must be configured; specify at least one of: `+
-			`--marathon-url, --kubeconfig/--kube-namespace/--kube-service-name/--kube-pod-label-selector, --static-endpoints`)
+			`--marathon-url, --kubeconfig/--kube-namespace/--kube-service-name/--kube-pod-label-selector, --dns-srv-names/--dns-a-names, --consul-url/--consul-service, --http-sd-url, --endpoints-file`)
 	}
 
 	return locators
 }
 
+// splitList splits a comma-separated flag value, ignoring empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.Trim(item, " \n"); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func argError(c *cli.Context, msg string, args ...interface{}) {
 	log.Errorf(msg+"\n", args...)
 	cli.ShowAppHelp(c)
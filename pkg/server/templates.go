@@ -153,14 +153,16 @@ var clusterStatusTemplate = `
 					<th>Endpoint</th>
 					<th>Selected</th>
 					<th>Uptime</th>
+					<th>Labels</th>
 					<th><code>{{.RouterStatus.ComparisonMetric}}</code></th>
 				</tr>
-				{{block "list" .RouterStatus.Endpoints}}{{range .}}
+				{{block "list" .RouterStatus}}{{range .Endpoints}}
 				<tr>
 					<td><a href="{{.Address}}/status">{{.Address}}</a></td>
-					<td>{{if .Selected}}<span class="glyphicon glyphicon-check" aria-hidden="true"></span>{{end}}</td>
-					<td>{{if .Uptime}}{{.Uptime}}{{else}}<span class="glyphicon glyphicon-remove" aria-hidden="true"></span><em>&nbsp; unavailable</em>{{end}}</td>
-					<td>{{.ComparisonMetricValue}}</td>
+					<td>{{if .Selected}}<span class="glyphicon glyphicon-check" aria-hidden="true"></span>{{with index $.Ejections .Address}} <span class="label label-danger">ejected</span><em>&nbsp; {{.}}</em>{{end}}{{with index $.Circuits .Address}} <span class="label label-warning">circuit breaker</span><em>&nbsp; {{.}}</em>{{end}}{{else if .EliminatedBy}}<em>eliminated by <code>{{.EliminatedBy}}</code> (stage {{.EliminatedAt}})</em>{{end}}</td>
+					<td>{{if not .Ready}}<span class="label label-warning">not ready</span><em>&nbsp; {{.NotReadyReason}}</em>{{else if .Uptime}}{{.Uptime}}{{else}}<span class="glyphicon glyphicon-remove" aria-hidden="true"></span><em>&nbsp; unavailable</em>{{end}}</td>
+					<td>{{range $name, $value := .Labels}}<span class="label label-default">{{$name}}="{{$value}}"</span> {{end}}</td>
+					<td>{{.ComparisonMetricValue}}{{with .ComparisonMetricName}}&nbsp; <small><code>{{.}}</code></small>{{end}}</td>
 				</tr>
 				{{end}}{{end}}
 			</tbody>
@@ -0,0 +1,67 @@
+package testhelpers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// EmptyVector is the data of a query response having no results
+const EmptyVector = `{"resultType":"vector","result":[]}`
+
+// Vector returns the data of a query response having a single result with the provided value
+func Vector(value string) string {
+	return fmt.Sprintf(`{"resultType":"vector","result":[{"metric":{},"value":[1502134929.97,"%s"]}]}`, value)
+}
+
+// FakePrometheus serves Metrics at '/metrics', and answers each query with the data configured
+// for it in Queries; other queries (such as 'up') are answered with an empty vector
+type FakePrometheus struct {
+	Metrics string
+	Queries map[string]string
+	// QueryRange, when set, provides the data of the responses to range queries
+	QueryRange func(query string, start, end time.Time, step time.Duration) string
+	// Delay is applied before every response
+	Delay   time.Duration
+	scrapes int32
+}
+
+// NewFakePrometheus starts a fake prometheus server with the provided scrape body and query responses
+func NewFakePrometheus(metrics string, queries map[string]string) *httptest.Server {
+	return httptest.NewServer(&FakePrometheus{Metrics: metrics, Queries: queries})
+}
+
+// Scrapes returns the number of times '/metrics' has been requested
+func (p *FakePrometheus) Scrapes() int {
+	return int(atomic.LoadInt32(&p.scrapes))
+}
+
+func (p *FakePrometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(p.Delay)
+	switch r.URL.Path {
+	case "/metrics":
+		atomic.AddInt32(&p.scrapes, 1)
+		w.Write([]byte(p.Metrics))
+	case "/api/v1/query":
+		data, ok := p.Queries[r.FormValue("query")]
+		if !ok {
+			data = EmptyVector
+		}
+		fmt.Fprintf(w, `{"status":"success","data":%s}`, data)
+	case "/api/v1/query_range":
+		if p.QueryRange == nil {
+			http.NotFound(w, r)
+			return
+		}
+		start, _ := time.Parse(time.RFC3339Nano, r.FormValue("start"))
+		end, _ := time.Parse(time.RFC3339Nano, r.FormValue("end"))
+		step, _ := strconv.ParseFloat(r.FormValue("step"), 64)
+		data := p.QueryRange(r.FormValue("query"), start, end, time.Duration(step*float64(time.Second)))
+		fmt.Fprintf(w, `{"status":"success","data":%s}`, data)
+	default:
+		http.NotFound(w, r)
+	}
+}